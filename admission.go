@@ -0,0 +1,320 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"gopkg.in/yaml.v3"
+)
+
+// AdmissionPolicy defines limits which are checked before a job is
+// submitted. Zero values and empty lists don't limit.
+//
+//	maxTasksPerJob: 1000
+//	maxConcurrentJobs: 20
+//	allowedMachineFamilies: ["e2", "n2", "g2"]
+//	allowedAccelerators: ["nvidia-l4", "nvidia-tesla-t4"]
+//	maxJobCost: 100
+//	maxSessionCost: 1000
+//	defaultRuntime: 24h
+type AdmissionPolicy struct {
+	// MaxTasksPerJob is the maximum amount of tasks of all task
+	// groups of a job
+	MaxTasksPerJob int64 `json:"maxTasksPerJob,omitempty" yaml:"maxTasksPerJob,omitempty"`
+	// MaxConcurrentJobs is the maximum amount of queued and running
+	// jobs of the job session
+	MaxConcurrentJobs int `json:"maxConcurrentJobs,omitempty" yaml:"maxConcurrentJobs,omitempty"`
+	// AllowedMachineFamilies are the allowed machine families (like "n2")
+	AllowedMachineFamilies []string `json:"allowedMachineFamilies,omitempty" yaml:"allowedMachineFamilies,omitempty"`
+	// AllowedAccelerators are the allowed GPU types (attached or
+	// built-in like "nvidia-tesla-t4")
+	AllowedAccelerators []string `json:"allowedAccelerators,omitempty" yaml:"allowedAccelerators,omitempty"`
+	// MaxJobCost is the maximum estimated cost of a job in USD
+	MaxJobCost float64 `json:"maxJobCost,omitempty" yaml:"maxJobCost,omitempty"`
+	// MaxSessionCost is the maximum cost of all jobs of the job session
+	// in USD: the cost of finished jobs and the estimated cost of the
+	// unfinished jobs and the new job. Jobs of the session whose cost
+	// is unknown (like jobs using instance templates) are ignored. Each
+	// AddJob() lists all jobs of the job session (all jobs of the
+	// location for the session "") until they are deleted, which gets
+	// slow for sessions with many jobs.
+	MaxSessionCost float64 `json:"maxSessionCost,omitempty" yaml:"maxSessionCost,omitempty"`
+	// DefaultRuntime is the runtime for estimating the cost of jobs
+	// without runtime limit (like "24h"). The cost of jobs without
+	// runtime can't be estimated and they are rejected when a cost
+	// limit is set.
+	DefaultRuntime string `json:"defaultRuntime,omitempty" yaml:"defaultRuntime,omitempty"`
+}
+
+// AdmissionError is returned when a job violates the admission policy.
+type AdmissionError struct {
+	Violations []string
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("job rejected by admission policy: %s",
+		strings.Join(e.Violations, "; "))
+}
+
+// LoadAdmissionPolicy reads the admission policy from a YAML or JSON file.
+func LoadAdmissionPolicy(file string) (AdmissionPolicy, error) {
+	var policy AdmissionPolicy
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return policy, fmt.Errorf("could not read admission policy %s: %v", file, err)
+	}
+	if err := yaml.Unmarshal(content, &policy); err != nil {
+		return policy, fmt.Errorf("could not parse admission policy %s: %v", file, err)
+	}
+	return policy, nil
+}
+
+// SetAdmissionPolicy sets the admission policy which is checked by
+// AddJob() before a job is submitted.
+func (t *GCPBatchTracker) SetAdmissionPolicy(policy AdmissionPolicy) error {
+	if policy.DefaultRuntime != "" {
+		if _, err := time.ParseDuration(policy.DefaultRuntime); err != nil {
+			return fmt.Errorf("invalid default runtime %s: %v", policy.DefaultRuntime, err)
+		}
+	}
+	t.admissionPolicy = &policy
+	return nil
+}
+
+// SetAdmissionPolicyFromFile sets the admission policy from a YAML or
+// JSON file (see AdmissionPolicy).
+func (t *GCPBatchTracker) SetAdmissionPolicyFromFile(file string) error {
+	policy, err := LoadAdmissionPolicy(file)
+	if err != nil {
+		return err
+	}
+	return t.SetAdmissionPolicy(policy)
+}
+
+// CheckAdmission checks the job against the admission policy and
+// returns an *AdmissionError listing all violations.
+func (p AdmissionPolicy) CheckAdmission(location string, job *batchpb.Job) error {
+	violations := p.jobViolations(location, job)
+	if len(violations) > 0 {
+		return &AdmissionError{Violations: violations}
+	}
+	return nil
+}
+
+// jobViolations returns the violations of the limits which only depend
+// on the job itself.
+func (p AdmissionPolicy) jobViolations(location string, job *batchpb.Job) []string {
+	var violations []string
+	var tasks int64
+	for _, group := range job.GetTaskGroups() {
+		taskCount := group.GetTaskCount()
+		if taskCount < 1 {
+			taskCount = 1
+		}
+		tasks += taskCount
+	}
+	if p.MaxTasksPerJob > 0 && tasks > p.MaxTasksPerJob {
+		violations = append(violations, fmt.Sprintf(
+			"job has %d tasks (max. %d)", tasks, p.MaxTasksPerJob))
+	}
+	for _, instance := range job.GetAllocationPolicy().GetInstances() {
+		policy := instance.GetPolicy()
+		if policy == nil {
+			if len(p.AllowedMachineFamilies) > 0 || len(p.AllowedAccelerators) > 0 {
+				violations = append(violations, fmt.Sprintf(
+					"instance template %s is not allowed when machine families or accelerators are restricted",
+					instance.GetInstanceTemplate()))
+			}
+			continue
+		}
+		family := machineFamily(policy.MachineType)
+		if len(p.AllowedMachineFamilies) > 0 && !contains(p.AllowedMachineFamilies, family) {
+			violations = append(violations, fmt.Sprintf(
+				"machine family %s of machine type %s is not allowed (allowed: %s)",
+				family, policy.MachineType, strings.Join(p.AllowedMachineFamilies, ", ")))
+		}
+		accelerators := make([]string, 0, len(policy.GetAccelerators())+1)
+		if m, _ := GetMachineType(policy.MachineType); m.GPUs > 0 {
+			accelerators = append(accelerators, m.GPUType)
+		}
+		for _, accelerator := range policy.GetAccelerators() {
+			accelerators = append(accelerators, accelerator.Type)
+		}
+		for _, accelerator := range accelerators {
+			if len(p.AllowedAccelerators) > 0 && !contains(p.AllowedAccelerators, accelerator) {
+				violations = append(violations, fmt.Sprintf(
+					"accelerator %s is not allowed (allowed: %s)",
+					accelerator, strings.Join(p.AllowedAccelerators, ", ")))
+			}
+		}
+	}
+	if p.MaxJobCost > 0 {
+		cost, err := p.estimateCost(location, job)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf(
+				"cost of job can't be estimated: %v", err))
+		} else if cost > p.MaxJobCost {
+			violations = append(violations, fmt.Sprintf(
+				"estimated cost of job is %s USD (max. %s USD)",
+				FormatCost(cost), FormatCost(p.MaxJobCost)))
+		}
+	}
+	return violations
+}
+
+// runtime returns the max. run duration of the job or the default
+// runtime of the policy.
+func (p AdmissionPolicy) runtime(job *batchpb.Job) (time.Duration, error) {
+	var runtime time.Duration
+	for _, group := range job.GetTaskGroups() {
+		if d := group.GetTaskSpec().GetMaxRunDuration().AsDuration(); d > runtime {
+			runtime = d
+		}
+	}
+	if runtime > 0 {
+		return runtime, nil
+	}
+	if p.DefaultRuntime == "" {
+		return 0, fmt.Errorf("job has no runtime limit and the admission policy has no default runtime")
+	}
+	return time.ParseDuration(p.DefaultRuntime)
+}
+
+// estimateCost returns the estimated cost of the job running for its
+// runtime limit.
+func (p AdmissionPolicy) estimateCost(location string, job *batchpb.Job) (float64, error) {
+	runtime, err := p.runtime(job)
+	if err != nil {
+		return 0, err
+	}
+	cost, err := GetPriceTable().JobCost(location, job, runtime)
+	if err != nil {
+		return 0, err
+	}
+	return cost.Total, nil
+}
+
+// isActiveJob returns true if the job is queued or running.
+func isActiveJob(job *batchpb.Job) bool {
+	switch job.GetStatus().GetState() {
+	case batchpb.JobStatus_SUCCEEDED, batchpb.JobStatus_FAILED,
+		batchpb.JobStatus_DELETION_IN_PROGRESS:
+		return false
+	}
+	return true
+}
+
+// sessionViolations returns the violations of the limits of the job
+// session when the job is added to the jobs of the session.
+func (p AdmissionPolicy) sessionViolations(location string, job *batchpb.Job, sessionJobs []*batchpb.Job) []string {
+	var violations []string
+	if p.MaxConcurrentJobs > 0 {
+		active := 0
+		for _, sessionJob := range sessionJobs {
+			if isActiveJob(sessionJob) {
+				active++
+			}
+		}
+		if active >= p.MaxConcurrentJobs {
+			violations = append(violations, fmt.Sprintf(
+				"job session has %d queued or running jobs (max. %d)",
+				active, p.MaxConcurrentJobs))
+		}
+	}
+	if p.MaxSessionCost > 0 {
+		total, err := p.estimateCost(location, job)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf(
+				"cost of job session can't be estimated: %v", err))
+			return violations
+		}
+		unknown := 0
+		for _, sessionJob := range sessionJobs {
+			cost, err := p.sessionJobCost(location, sessionJob)
+			if err != nil {
+				// don't reject new jobs because of jobs which can't be
+				// priced (like jobs using instance templates)
+				unknown++
+				continue
+			}
+			total += cost
+		}
+		if total > p.MaxSessionCost {
+			violation := fmt.Sprintf(
+				"estimated cost of job session is %s USD (max. %s USD)",
+				FormatCost(total), FormatCost(p.MaxSessionCost))
+			if unknown > 0 {
+				violation += fmt.Sprintf("; jobs of unknown cost ignored: %d", unknown)
+			}
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// sessionJobCost returns the estimated cost of an unfinished job or the
+// cost of a finished job of the job session.
+func (p AdmissionPolicy) sessionJobCost(location string, job *batchpb.Job) (float64, error) {
+	if isActiveJob(job) {
+		return p.estimateCost(location, job)
+	}
+	cost, err := GetPriceTable().JobCost(location, job,
+		job.GetStatus().GetRunDuration().AsDuration())
+	return cost.Total, err
+}
+
+// admitJob checks the job request against the admission policy of the
+// tracker before the job is submitted.
+func (t *GCPBatchTracker) admitJob(req *batchpb.CreateJobRequest) error {
+	if t.admissionPolicy == nil {
+		return nil
+	}
+	policy := *t.admissionPolicy
+	violations := policy.jobViolations(t.location, req.Job)
+	if policy.MaxConcurrentJobs > 0 || policy.MaxSessionCost > 0 {
+		// the session cost includes the cost of finished jobs
+		sessionJobs, err := t.sessionJobs(policy.MaxSessionCost <= 0)
+		if err != nil {
+			return fmt.Errorf("could not check admission policy: %v", err)
+		}
+		violations = append(violations,
+			policy.sessionViolations(t.location, req.Job, sessionJobs)...)
+	}
+	if len(violations) > 0 {
+		return &AdmissionError{Violations: violations}
+	}
+	return nil
+}
+
+// sessionJobs returns the jobs of the job session in the location of
+// the tracker. If activeOnly is true only the queued and running jobs
+// are listed.
+func (t *GCPBatchTracker) sessionJobs(activeOnly bool) ([]*batchpb.Job, error) {
+	var filters []*drmaa2interface.JobInfo
+	if activeOnly {
+		for _, state := range []drmaa2interface.JobState{drmaa2interface.Queued, drmaa2interface.Running} {
+			filter := drmaa2interface.CreateJobInfo()
+			filter.State = state
+			filters = append(filters, &filter)
+		}
+	} else {
+		filters = append(filters, nil)
+	}
+	var jobs []*batchpb.Job
+	for _, filter := range filters {
+		batchJobs, err := t.listBatchJobs(t.listJobsRequest(true, filter))
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range batchJobs {
+			if t.drmaa2session == "" || IsInJobSession(t.drmaa2session, job) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs, nil
+}
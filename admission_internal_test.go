@@ -0,0 +1,65 @@
+package gcpbatchtracker
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var _ = Describe("Admission internals", func() {
+
+	newJob := func(state batchpb.JobStatus_State) *batchpb.Job {
+		req, err := ConvertJobTemplateToJobRequest("", "p", "us-central1",
+			drmaa2interface.JobTemplate{
+				JobCategory:       "busybox",
+				CandidateMachines: []string{"e2-standard-4"},
+				ResourceLimits:    map[string]string{"runtime": "1h"},
+			})
+		Expect(err).To(BeNil())
+		req.Job.Status = &batchpb.JobStatus{
+			State:       state,
+			RunDuration: durationpb.New(time.Hour),
+		}
+		return req.Job
+	}
+
+	It("should count the queued and running jobs of the session", func() {
+		policy := AdmissionPolicy{MaxConcurrentJobs: 2}
+		sessionJobs := []*batchpb.Job{
+			newJob(batchpb.JobStatus_QUEUED),
+			newJob(batchpb.JobStatus_SUCCEEDED),
+		}
+		Expect(policy.sessionViolations("us-central1", newJob(batchpb.JobStatus_QUEUED),
+			sessionJobs)).To(BeEmpty())
+		sessionJobs = append(sessionJobs, newJob(batchpb.JobStatus_RUNNING))
+		Expect(policy.sessionViolations("us-central1", newJob(batchpb.JobStatus_QUEUED),
+			sessionJobs)).To(HaveLen(1))
+	})
+
+	It("should ignore session jobs which can't be priced", func() {
+		job := newJob(batchpb.JobStatus_QUEUED)
+		cost, err := AdmissionPolicy{}.estimateCost("us-central1", job)
+		Expect(err).To(BeNil())
+
+		unpriceable := newJob(batchpb.JobStatus_SUCCEEDED)
+		unpriceable.AllocationPolicy.Instances[0].PolicyTemplate =
+			&batchpb.AllocationPolicy_InstancePolicyOrTemplate_InstanceTemplate{
+				InstanceTemplate: "template",
+			}
+		policy := AdmissionPolicy{MaxSessionCost: 2.5 * cost}
+		sessionJobs := []*batchpb.Job{newJob(batchpb.JobStatus_SUCCEEDED), unpriceable}
+		Expect(policy.sessionViolations("us-central1", job, sessionJobs)).To(BeEmpty())
+
+		sessionJobs = append(sessionJobs, newJob(batchpb.JobStatus_RUNNING))
+		violations := policy.sessionViolations("us-central1", job, sessionJobs)
+		Expect(violations).To(HaveLen(1))
+		Expect(violations[0]).To(ContainSubstring("estimated cost of job session"))
+		Expect(violations[0]).To(HaveSuffix("; jobs of unknown cost ignored: 1"))
+	})
+
+})
@@ -0,0 +1,114 @@
+package gcpbatchtracker_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Admission policy", func() {
+
+	plan := func(jt drmaa2interface.JobTemplate) *batchpb.Job {
+		req, _, err := (&GCPBatchTracker{}).PlanJob(jt)
+		Expect(err).To(BeNil())
+		return req.Job
+	}
+
+	var jt drmaa2interface.JobTemplate
+
+	BeforeEach(func() {
+		jt = drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"a2-ultragpu-8g"},
+			MinSlots:          100000,
+			MaxSlots:          100000,
+		}
+	})
+
+	It("should reject jobs with too many tasks", func() {
+		policy := AdmissionPolicy{MaxTasksPerJob: 1000}
+		err := policy.CheckAdmission("us-central1", plan(jt))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("job has 100000 tasks (max. 1000)"))
+		jt.MinSlots, jt.MaxSlots = 10, 10
+		Expect(policy.CheckAdmission("us-central1", plan(jt))).To(Succeed())
+	})
+
+	It("should reject machine families and accelerators which are not allowed", func() {
+		policy := AdmissionPolicy{
+			AllowedMachineFamilies: []string{"e2", "g2"},
+			AllowedAccelerators:    []string{"nvidia-l4"},
+		}
+		err := policy.CheckAdmission("us-central1", plan(jt))
+		var admissionErr *AdmissionError
+		Expect(errors.As(err, &admissionErr)).To(BeTrue())
+		Expect(admissionErr.Violations).To(HaveLen(2))
+		Expect(admissionErr.Violations[0]).To(ContainSubstring("machine family a2"))
+		Expect(admissionErr.Violations[1]).To(ContainSubstring("accelerator nvidia-a100-80gb"))
+
+		jt.CandidateMachines = []string{"g2-standard-8"}
+		Expect(policy.CheckAdmission("us-central1", plan(jt))).To(Succeed())
+		jt.CandidateMachines = []string{"e2-standard-4"}
+		jt = SetAcceleratorsExtension(jt, 1, "nvidia-tesla-t4")
+		Expect(policy.CheckAdmission("us-central1", plan(jt))).NotTo(Succeed())
+	})
+
+	It("should reject jobs which are too expensive", func() {
+		policy := AdmissionPolicy{MaxJobCost: 100}
+		// no runtime
+		err := policy.CheckAdmission("us-central1", plan(jt))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no runtime limit"))
+
+		policy.DefaultRuntime = "1h"
+		err = policy.CheckAdmission("us-central1", plan(jt))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("estimated cost of job"))
+
+		jt.CandidateMachines = []string{"e2-standard-4"}
+		jt.MinSlots, jt.MaxSlots = 1, 1
+		jt.ResourceLimits = map[string]string{"runtime": "2h"}
+		Expect(policy.CheckAdmission("us-central1", plan(jt))).To(Succeed())
+	})
+
+	It("should reject jobs in AddJob before submission", func() {
+		tracker := &GCPBatchTracker{}
+		Expect(tracker.SetAdmissionPolicy(AdmissionPolicy{DefaultRuntime: "one day"})).NotTo(Succeed())
+		Expect(tracker.SetAdmissionPolicy(AdmissionPolicy{MaxTasksPerJob: 10})).To(Succeed())
+		_, err := tracker.AddJob(jt)
+		var admissionErr *AdmissionError
+		Expect(errors.As(err, &admissionErr)).To(BeTrue())
+	})
+
+	It("should load the admission policy from a file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "policy.yaml")
+		Expect(os.WriteFile(file, []byte(`maxTasksPerJob: 1000
+maxConcurrentJobs: 20
+allowedMachineFamilies: ["e2", "n2"]
+allowedAccelerators: ["nvidia-l4"]
+maxJobCost: 100
+maxSessionCost: 1000
+defaultRuntime: 24h
+`), 0600)).To(Succeed())
+		policy, err := LoadAdmissionPolicy(file)
+		Expect(err).To(BeNil())
+		Expect(policy).To(Equal(AdmissionPolicy{
+			MaxTasksPerJob:         1000,
+			MaxConcurrentJobs:      20,
+			AllowedMachineFamilies: []string{"e2", "n2"},
+			AllowedAccelerators:    []string{"nvidia-l4"},
+			MaxJobCost:             100,
+			MaxSessionCost:         1000,
+			DefaultRuntime:         "24h",
+		}))
+		Expect((&GCPBatchTracker{}).SetAdmissionPolicyFromFile(file)).To(Succeed())
+	})
+
+})
@@ -24,6 +24,9 @@ func init() {
 type GoogleBatchTrackerParams struct {
 	GoogleProjectID string
 	Region          string
+	// Regions creates a MultiLocationTracker for jobs in all regions
+	// (Region is ignored then)
+	Regions []string
 }
 
 type allocator struct{}
@@ -39,6 +42,11 @@ func (a *allocator) New(jobSessionName string, jobTrackerInitParams interface{})
 		if !ok {
 			return nil, errors.New("jobTrackerInitParams for podman has not PodmanTrackerParams type")
 		}
+		if len(googleBatchParams.Regions) > 0 {
+			return NewMultiLocationTracker(jobSessionName,
+				googleBatchParams.GoogleProjectID,
+				googleBatchParams.Regions)
+		}
 		return NewGCPBatchTracker(jobSessionName,
 			googleBatchParams.GoogleProjectID,
 			googleBatchParams.Region)
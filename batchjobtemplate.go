@@ -0,0 +1,448 @@
+package gcpbatchtracker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+// Reverse conversion of a Google Batch job into a DRMAA2 job template.
+// This is required for jobs which are not submitted through this
+// package (gcloud, Terraform, console) and hence do not have the job
+// template stored in the DRMAA2_JOB_TEMPLATE environment variable.
+
+// BatchJobToJobTemplate reconstructs the DRMAA2 job template from the
+// spec of the first task group of the Google Batch job. It does not use
+// the job template stored in the environment variables of the job.
+// Jobs without instance policy (like jobs created by gcloud without
+// machine type) result in a job template without CandidateMachines
+// which needs to be set before the job template can be submitted.
+func BatchJobToJobTemplate(job *batchpb.Job) (drmaa2interface.JobTemplate, error) {
+	if job == nil {
+		return drmaa2interface.JobTemplate{}, errors.New("batch job is nil")
+	}
+	if len(job.GetTaskGroups()) == 0 {
+		return drmaa2interface.JobTemplate{}, errors.New("batch job has no task group")
+	}
+	return BatchTaskGroupToJobTemplate(job, job.TaskGroups[0])
+}
+
+// BatchTaskGroupToJobTemplate reconstructs the DRMAA2 job template of a
+// task group of the Google Batch job.
+func BatchTaskGroupToJobTemplate(job *batchpb.Job, group *batchpb.TaskGroup) (drmaa2interface.JobTemplate, error) {
+	jt := drmaa2interface.JobTemplate{
+		Priority:     int64(job.Priority),
+		AccountingID: accountingID(job),
+		MinSlots:     group.Parallelism,
+		MaxSlots:     group.TaskCount,
+	}
+	if job.Name != "" {
+		jt.JobName = path.Base(job.Name)
+	}
+	jt.QueueName, _ = DecodeLabelValue(job.Labels[LabelQueue])
+	if jt.MinSlots == 0 {
+		jt.MinSlots = 1
+	}
+	if jt.MaxSlots == 0 {
+		jt.MaxSlots = 1
+	}
+	if labels := userLabels(job.Labels); labels != nil {
+		var err error
+		if jt, err = SetLabelsExtension(jt, labels); err != nil {
+			return jt, err
+		}
+	}
+
+	if job.GetLogsPolicy().GetDestination() == batchpb.LogsPolicy_PATH {
+		jt.OutputPath = job.LogsPolicy.LogsPath
+	}
+
+	jt = allocationPolicyToJobTemplate(jt, job.GetAllocationPolicy())
+
+	taskSpec := group.GetTaskSpec()
+	if taskSpec == nil {
+		return jt, fmt.Errorf("task group %s has no task spec", group.Name)
+	}
+
+	// environment
+	for k, v := range taskSpec.GetEnvironment().GetVariables() {
+		if k == EnvJobTemplate || k == EnvStageOutFiles {
+			continue
+		}
+		if jt.JobEnvironment == nil {
+			jt.JobEnvironment = make(map[string]string)
+		}
+		jt.JobEnvironment[k] = v
+	}
+	if secrets := taskSpec.GetEnvironment().GetSecretVariables(); len(secrets) > 0 {
+		var err error
+		if jt, err = SetSecretEnvironmentVariables(jt, secrets); err != nil {
+			return jt, err
+		}
+	}
+
+	jt = computeResourceToJobTemplate(jt, taskSpec, group.TaskCountPerNode)
+
+	// retries
+	if taskSpec.MaxRetryCount > 0 {
+		jt = SetMaxRetryCountExtension(jt, taskSpec.MaxRetryCount)
+	}
+	var retryExitCodes, failExitCodes []int32
+	for _, policy := range taskSpec.GetLifecyclePolicies() {
+		switch policy.Action {
+		case batchpb.LifecyclePolicy_RETRY_TASK:
+			retryExitCodes = append(retryExitCodes, policy.GetActionCondition().GetExitCodes()...)
+		case batchpb.LifecyclePolicy_FAIL_TASK:
+			failExitCodes = append(failExitCodes, policy.GetActionCondition().GetExitCodes()...)
+		}
+	}
+	if len(retryExitCodes) > 0 || len(failExitCodes) > 0 {
+		jt = SetLifecyclePoliciesExtension(jt, retryExitCodes, failExitCodes)
+	}
+
+	// runnables
+	var err error
+	prolog, main, epilog, isDefaultLayout := matchDefaultLayout(taskSpec.Runnables)
+	if isDefaultLayout {
+		if prolog != "" && prolog != `#!/bin/sh` {
+			jt = SetMachinePrologExtension(jt, prolog)
+		}
+		if epilog != "" {
+			jt = SetMachineEpilogExtension(jt, epilog)
+		}
+		if jt, err = mainRunnableToJobTemplate(jt, main); err != nil {
+			return jt, err
+		}
+	} else {
+		specs := batchRunnablesToSpecs(taskSpec.Runnables)
+		if jt, err = SetRunnablesExtension(jt, specs); err != nil {
+			return jt, err
+		}
+		if main := firstContainer(taskSpec.Runnables); main != nil {
+			jt = containerSettingsToJobTemplate(jt, main.GetContainer(), false)
+		}
+	}
+
+	// stage in and stage out files
+	jt.StageInFiles = volumesToStageInFiles(taskSpec.Volumes,
+		firstContainer(taskSpec.Runnables).GetContainer())
+	jt.StageOutFiles, err = stageOutFiles(jt.StageInFiles,
+		taskSpec.GetEnvironment().GetVariables()[EnvStageOutFiles])
+	if err != nil {
+		return jt, err
+	}
+	if len(jt.StageInFiles) == 0 {
+		jt.StageInFiles = nil
+	}
+
+	return jt, nil
+}
+
+func allocationPolicyToJobTemplate(jt drmaa2interface.JobTemplate, policy *batchpb.AllocationPolicy) drmaa2interface.JobTemplate {
+	if policy == nil {
+		return jt
+	}
+	if placement := policy.GetPlacement(); placement != nil {
+		jt = SetPlacementPolicyExtension(jt, placement.Collocation, placement.MaxDistance)
+	}
+	if interfaces := policy.GetNetwork().GetNetworkInterfaces(); len(interfaces) > 0 {
+		jt = SetNetworkExtension(jt, interfaces[0].Network, interfaces[0].Subnetwork)
+	}
+	if email := policy.GetServiceAccount().GetEmail(); email != "" {
+		jt = SetServiceAccountExtension(jt, email)
+	}
+	if locations := policy.GetLocation().GetAllowedLocations(); len(locations) > 0 {
+		jt = SetAllowedLocationsExtension(jt, locations)
+	}
+	instances := policy.GetInstances()
+	if len(instances) == 0 {
+		return jt
+	}
+	if template := instances[0].GetInstanceTemplate(); template != "" {
+		jt.CandidateMachines = []string{"template:" + template}
+		return jt
+	}
+	instancePolicy := instances[0].GetPolicy()
+	if instancePolicy == nil {
+		return jt
+	}
+	jt.CandidateMachines = []string{instancePolicy.MachineType}
+	jt.MachineArch = instancePolicy.MinCpuPlatform
+	if instancePolicy.ProvisioningModel == batchpb.AllocationPolicy_SPOT {
+		jt = SetSpotExtension(jt, true)
+	}
+	if accelerators := instancePolicy.GetAccelerators(); len(accelerators) > 0 {
+		jt = SetAcceleratorsExtension(jt, accelerators[0].Count, accelerators[0].Type)
+	}
+	if disk := instancePolicy.GetBootDisk(); disk != nil {
+		jt = SetBootDiskExtension(jt, disk.GetImage(), disk.Type, disk.SizeGb)
+	}
+	if instancePolicy.Reservation != "" {
+		jt = SetReservationExtension(jt, instancePolicy.Reservation)
+	}
+	return jt
+}
+
+func computeResourceToJobTemplate(jt drmaa2interface.JobTemplate, taskSpec *batchpb.TaskSpec, tasksPerNode int64) drmaa2interface.JobTemplate {
+	limits := make(map[string]string)
+	if taskSpec.MaxRunDuration != nil {
+		limits[ResourceLimitRuntime] = taskSpec.MaxRunDuration.AsDuration().String()
+	}
+	machine := ""
+	if len(jt.CandidateMachines) > 0 {
+		machine = jt.CandidateMachines[0]
+	}
+	var cpuMilli int64
+	if resources := taskSpec.GetComputeResource(); resources != nil {
+		if tasksPerNode <= 1 || resources.MemoryMib != DefaultTaskMemoryMiB(machine, tasksPerNode) {
+			jt.MinPhysMemory = resources.MemoryMib
+		}
+		if resources.CpuMilli != 0 && resources.CpuMilli != DefaultTaskCPUMilli(machine, tasksPerNode) {
+			cpuMilli = resources.CpuMilli
+			limits[ResourceLimitCPUMilli] = strconv.FormatInt(resources.CpuMilli, 10)
+		}
+		_, _, bootDiskSizeGB, _ := GetBootDiskExtension(jt)
+		if resources.BootDiskMib != 0 && resources.BootDiskMib != defaultBootDiskMib &&
+			resources.BootDiskMib != bootDiskSizeGB*1024 {
+			limits[ResourceLimitBootDisk] = strconv.FormatInt(resources.BootDiskMib, 10)
+		}
+	}
+	// tasks per node which are not derived from the task resources
+	if tasksPerNode > 1 && tasksPerNode != autoTasksPerNode(machine, cpuMilli, jt.MinPhysMemory) {
+		requested := taskSpec.GetComputeResource().GetCpuMilli()
+		if cpuMilli == 0 && requested != 0 &&
+			tasksPerNode == autoTasksPerNode(machine, requested, jt.MinPhysMemory) {
+			// requested CPU milli cores match the default
+			limits[ResourceLimitCPUMilli] = strconv.FormatInt(requested, 10)
+		} else {
+			jt = SetTasksPerNodeExtension(jt, tasksPerNode)
+		}
+	}
+	if len(limits) > 0 {
+		jt.ResourceLimits = limits
+	}
+	return jt
+}
+
+// matchDefaultLayout checks if the runnables have the layout created by
+// CreateRunnables() (barrier, prolog, barrier, main, barrier, epilog)
+// or if it is just a single runnable.
+func matchDefaultLayout(runnables []*batchpb.Runnable) (string, *batchpb.Runnable, string, bool) {
+	if len(runnables) == 1 {
+		return "", runnables[0], "", true
+	}
+	i := 0
+	next := func() *batchpb.Runnable {
+		if i >= len(runnables) {
+			return nil
+		}
+		i++
+		return runnables[i-1]
+	}
+	isBarrier := func(r *batchpb.Runnable, name string) bool {
+		return r != nil && r.GetBarrier() != nil && r.GetBarrier().Name == name
+	}
+
+	barriers := isBarrier(runnables[0], "before_job_barrier")
+	if barriers {
+		next()
+	}
+	prolog := next()
+	if prolog == nil || prolog.GetScript() == nil || prolog.GetScript().GetText() == "" {
+		return "", nil, "", false
+	}
+	if barriers && !isBarrier(next(), "after_prolog_barrier") {
+		return "", nil, "", false
+	}
+	main := next()
+	if main == nil || main.GetBarrier() != nil {
+		return "", nil, "", false
+	}
+	epilog := ""
+	if r := next(); r != nil {
+		if barriers {
+			if !isBarrier(r, "after_job_barrier") {
+				return "", nil, "", false
+			}
+			r = next()
+		}
+		if r == nil || !r.AlwaysRun || r.GetScript().GetText() == "" {
+			return "", nil, "", false
+		}
+		epilog = r.GetScript().GetText()
+	}
+	if i != len(runnables) {
+		return "", nil, "", false
+	}
+	return prolog.GetScript().GetText(), main, epilog, true
+}
+
+func mainRunnableToJobTemplate(jt drmaa2interface.JobTemplate, main *batchpb.Runnable) (drmaa2interface.JobTemplate, error) {
+	switch {
+	case main.GetContainer() != nil:
+		container := main.GetContainer()
+		jt.JobCategory = container.ImageUri
+		jt.RemoteCommand = container.Entrypoint
+		jt.Args = container.Commands
+		jt = containerSettingsToJobTemplate(jt, container, true)
+	case main.GetScript() != nil && main.GetScript().GetPath() != "":
+		jt.JobCategory = JobCategoryScriptPath
+		jt.RemoteCommand = main.GetScript().GetPath()
+	case main.GetScript() != nil:
+		jt.JobCategory = JobCategoryScript
+		jt.RemoteCommand = main.GetScript().GetText()
+	default:
+		return jt, fmt.Errorf("unsupported runnable: %v", main)
+	}
+	return jt, nil
+}
+
+// containerSettingsToJobTemplate sets the registry credentials, container
+// options, and the security profile or docker options of the container.
+func containerSettingsToJobTemplate(jt drmaa2interface.JobTemplate, container *batchpb.Runnable_Container, withOptions bool) drmaa2interface.JobTemplate {
+	if container.Username != "" || container.Password != "" {
+		jt, _ = SetContainerRegistryCredentials(jt, container.Username, container.Password)
+	}
+	if container.EnableImageStreaming || container.BlockExternalNetwork {
+		jt = SetContainerOptionsExtension(jt, container.EnableImageStreaming,
+			container.BlockExternalNetwork)
+	}
+	if !withOptions {
+		return jt
+	}
+	// GPU device options are added by the conversion
+	options := strings.TrimSpace(strings.Split(container.Options, " --gpus all")[0])
+	if strings.HasPrefix(container.Options, "--gpus all") {
+		options = ""
+	}
+	for _, name := range []string{ContainerSecurityProfileMPI,
+		ContainerSecurityProfileDefault, ContainerSecurityProfileRestricted} {
+		profile, _ := GetContainerSecurityProfile(name)
+		if profile.ContainerOptions(container.BlockExternalNetwork) == options &&
+			hasVolumePrefix(container.Volumes, profile.Volumes) {
+			if name != ContainerSecurityProfileMPI {
+				jt = SetContainerSecurityProfileExtension(jt, name)
+			}
+			return jt
+		}
+	}
+	return SetDockerOptionsExtension(jt, container.Options)
+}
+
+func hasVolumePrefix(volumes, prefix []string) bool {
+	if len(volumes) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if volumes[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func firstContainer(runnables []*batchpb.Runnable) *batchpb.Runnable {
+	for _, r := range runnables {
+		if r.GetContainer() != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// batchRunnablesToSpecs converts Google Batch runnables into runnable
+// specs for the runnables extension.
+func batchRunnablesToSpecs(runnables []*batchpb.Runnable) []RunnableSpec {
+	specs := make([]RunnableSpec, 0, len(runnables))
+	for _, r := range runnables {
+		spec := RunnableSpec{
+			Background:       r.Background,
+			IgnoreExitStatus: r.IgnoreExitStatus,
+			AlwaysRun:        r.AlwaysRun,
+			Environment:      r.GetEnvironment().GetVariables(),
+		}
+		if r.Timeout != nil {
+			spec.Timeout = r.Timeout.AsDuration().String()
+		}
+		switch {
+		case r.GetContainer() != nil:
+			spec.Type = RunnableTypeContainer
+			spec.Image = r.GetContainer().ImageUri
+			spec.Entrypoint = r.GetContainer().Entrypoint
+			spec.Commands = r.GetContainer().Commands
+			spec.Options = r.GetContainer().Options
+		case r.GetScript() != nil:
+			spec.Type = RunnableTypeScript
+			spec.Script = r.GetScript().GetText()
+			spec.ScriptPath = r.GetScript().GetPath()
+		case r.GetBarrier() != nil:
+			spec.Type = RunnableTypeBarrier
+			spec.Name = r.GetBarrier().Name
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// stageOutFiles moves the buckets which are mounted at the stage out
+// paths (see EnvStageOutFiles) from the stage in files into the stage
+// out files. Without the stage out paths (like for jobs created by
+// gcloud) all buckets are stage in files.
+func stageOutFiles(stageIn map[string]string, stageOutPaths string) (map[string]string, error) {
+	if stageOutPaths == "" {
+		return nil, nil
+	}
+	var paths []string
+	if err := json.Unmarshal([]byte(stageOutPaths), &paths); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", EnvStageOutFiles, err)
+	}
+	stageOut := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if source, exists := stageIn[path]; exists && strings.HasPrefix(source, "gs://") {
+			stageOut[path] = source
+			delete(stageIn, path)
+		}
+	}
+	if len(stageOut) == 0 {
+		return nil, nil
+	}
+	return stageOut, nil
+}
+
+// volumesToStageInFiles converts GCS and NFS volumes into stage in files.
+// For containers the mounts from the host into the container are used
+// as destination.
+func volumesToStageInFiles(volumes []*batchpb.Volume, container *batchpb.Runnable_Container) map[string]string {
+	stageIn := make(map[string]string)
+	for _, volume := range volumes {
+		switch {
+		case volume.GetGcs() != nil:
+			stageIn[volume.MountPath] = "gs://" + volume.GetGcs().RemotePath
+		case volume.GetNfs() != nil:
+			nfs := volume.GetNfs()
+			found := false
+			if container != nil {
+				// container mounts like /mnt/share/file.sh:/home/user/file.sh
+				for _, v := range container.Volumes {
+					parts := strings.SplitN(v, ":", 2)
+					if len(parts) != 2 || !strings.HasPrefix(parts[0], volume.MountPath) {
+						continue
+					}
+					file := strings.TrimPrefix(parts[0], volume.MountPath)
+					stageIn[parts[1]] = "nfs:" + nfs.Server + ":" + nfs.RemotePath + file
+					found = true
+				}
+			}
+			if !found {
+				stageIn[volume.MountPath] = "nfs:" + nfs.Server + ":" + nfs.RemotePath
+			}
+		}
+	}
+	return stageIn
+}
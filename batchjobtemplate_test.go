@@ -0,0 +1,168 @@
+package gcpbatchtracker_test
+
+import (
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+// roundTrip converts the job template into a Batch job, removes the
+// stored job template, and converts it back.
+func roundTrip(jt drmaa2interface.JobTemplate) drmaa2interface.JobTemplate {
+	req, err := ConvertJobTemplateToJobRequest("session", "project", "location", jt)
+	Expect(err).To(BeNil())
+	req.Job.Name = req.Parent + "/jobs/" + req.JobId
+	delete(req.Job.TaskGroups[0].TaskSpec.Environment.Variables, EnvJobTemplate)
+	converted, err := BatchJobToJobTemplate(req.Job)
+	Expect(err).To(BeNil())
+	return converted
+}
+
+var _ = Describe("Batchjobtemplate", func() {
+
+	Context("Round trip", func() {
+
+		It("should reconstruct a container job template with extensions", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobName:           "roundtrip",
+				RemoteCommand:     "/bin/sh",
+				Args:              []string{"-c", "nvidia-smi"},
+				JobCategory:       "nvidia/cuda:12.0.0-base-ubuntu22.04",
+				AccountingID:      "project-a",
+				Priority:          10,
+				MinSlots:          2,
+				MaxSlots:          2,
+				CandidateMachines: []string{"n1-standard-8"},
+				MachineArch:       "Intel Skylake",
+				MinPhysMemory:     8192,
+				OutputPath:        "/mnt/share/logs",
+				JobEnvironment:    map[string]string{"KEY": "value"},
+				ResourceLimits: map[string]string{
+					ResourceLimitRuntime:  "1h0m0s",
+					ResourceLimitCPUMilli: "4000",
+				},
+				StageInFiles: map[string]string{
+					"/input":             "gs://inputbucket",
+					"/home/user/file.sh": "nfs:10.0.0.2:/share/file.sh",
+				},
+				StageOutFiles: map[string]string{
+					"/output": "gs://outputbucket/results",
+				},
+			}
+			jt = SetMachinePrologExtension(jt, "echo prolog")
+			jt = SetMachineEpilogExtension(jt, "echo epilog")
+			jt = SetSpotExtension(jt, true)
+			jt = SetAcceleratorsExtension(jt, 2, "nvidia-tesla-t4")
+			jt = SetBootDiskExtension(jt, "batch-hpc-centos", "pd-ssd", 100)
+			jt = SetMaxRetryCountExtension(jt, 3)
+			jt = SetLifecyclePoliciesExtension(jt, []int32{ExitCodeSpotPreemption}, []int32{1})
+			jt = SetContainerSecurityProfileExtension(jt, ContainerSecurityProfileRestricted)
+			jt = SetPlacementPolicyExtension(jt, "COLLOCATED", 0)
+			jt, err := SetSecretEnvironmentVariables(jt, map[string]string{
+				"PASSWORD": "projects/p/secrets/password/versions/1",
+			})
+			Expect(err).To(BeNil())
+
+			Expect(roundTrip(jt)).To(Equal(jt))
+		})
+
+		It("should reconstruct a script job template", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobName:           "script",
+				RemoteCommand:     "echo hello",
+				JobCategory:       JobCategoryScript,
+				MinSlots:          2,
+				MaxSlots:          10,
+				CandidateMachines: []string{"e2-standard-4"},
+			}
+			Expect(roundTrip(jt)).To(Equal(jt))
+
+			jt.JobCategory = JobCategoryScriptPath
+			jt.RemoteCommand = "/opt/run.sh"
+			jt.CandidateMachines = []string{"template:my-template"}
+			Expect(roundTrip(jt)).To(Equal(jt))
+		})
+
+		It("should reconstruct docker options and runnables", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobName:           "docker",
+				JobCategory:       "busybox",
+				MinSlots:          1,
+				MaxSlots:          1,
+				CandidateMachines: []string{"e2-standard-4"},
+			}
+			jt = SetDockerOptionsExtension(jt, "--rm --network=none")
+			Expect(roundTrip(jt)).To(Equal(jt))
+
+			jt = drmaa2interface.JobTemplate{
+				JobName:           "runnables",
+				MinSlots:          1,
+				MaxSlots:          1,
+				CandidateMachines: []string{"e2-standard-4"},
+			}
+			jt, err := SetRunnablesExtension(jt, []RunnableSpec{
+				{Type: RunnableTypeContainer, Image: "exporter", Background: true,
+					Options: "--network=host --ipc=host --pid=host --privileged --uts=host"},
+				{Type: RunnableTypeScript, Script: "echo step 1", Timeout: "1m0s"},
+				{Type: RunnableTypeScript, ScriptPath: "/step2.sh"},
+			})
+			Expect(err).To(BeNil())
+			Expect(roundTrip(jt)).To(Equal(jt))
+		})
+
+	})
+
+	Context("Jobs not created by DRMAA2", func() {
+
+		It("should convert a job created with gcloud", func() {
+			job := &batchpb.Job{
+				Name: "projects/p/locations/us-central1/jobs/gcloud-job",
+				TaskGroups: []*batchpb.TaskGroup{
+					{
+						TaskCount:   4,
+						Parallelism: 2,
+						TaskSpec: &batchpb.TaskSpec{
+							Volumes: []*batchpb.Volume{
+								{
+									Source: &batchpb.Volume_Gcs{
+										Gcs: &batchpb.GCS{RemotePath: "bucket"},
+									},
+									MountPath: "/mnt/bucket",
+								},
+							},
+							Runnables: []*batchpb.Runnable{
+								{
+									Executable: &batchpb.Runnable_Container_{
+										Container: &batchpb.Runnable_Container{
+											ImageUri: "gcr.io/google-containers/busybox",
+											Commands: []string{"-c", "echo hello"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			jt, err := BatchJobToJobTemplate(job)
+			Expect(err).To(BeNil())
+			Expect(jt.JobName).To(Equal("gcloud-job"))
+			Expect(jt.JobCategory).To(Equal("gcr.io/google-containers/busybox"))
+			Expect(jt.Args).To(Equal([]string{"-c", "echo hello"}))
+			Expect(jt.MinSlots).To(Equal(int64(2)))
+			Expect(jt.MaxSlots).To(Equal(int64(4)))
+			Expect(jt.CandidateMachines).To(BeNil())
+			// stage in and stage out buckets can't be distinguished
+			Expect(jt.StageInFiles).To(Equal(map[string]string{"/mnt/bucket": "gs://bucket"}))
+			Expect(jt.StageOutFiles).To(BeNil())
+
+			_, err = BatchJobToJobTemplate(nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
+
+})
@@ -179,8 +179,13 @@ func WriteToBucket(bucket string, file string, content []byte) error {
 		return err
 	}
 	writer := obj.NewWriter(context.Background())
-	defer writer.Close()
 	if _, err := writer.Write(content); err != nil {
+		writer.Close()
+		return fmt.Errorf("could not write object %s to bucket %s: %v",
+			file, bucket, err)
+	}
+	// the upload is finished (and can fail) when the writer is closed
+	if err := writer.Close(); err != nil {
 		return fmt.Errorf("could not write object %s to bucket %s: %v",
 			file, bucket, err)
 	}
@@ -0,0 +1,129 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dgruber/drmaa2interface"
+)
+
+const (
+	// ContainerSecurityProfileMPI runs the container privileged and in
+	// the host namespaces so that MPI jobs can use ssh and the hosts file
+	// of the task group. This is the default.
+	ContainerSecurityProfileMPI = "mpi"
+	// ContainerSecurityProfileDefault runs the container unprivileged in
+	// the host network with access to the hosts file of the task group.
+	ContainerSecurityProfileDefault = "default"
+	// ContainerSecurityProfileRestricted runs the container unprivileged
+	// without any host mounts and without gaining new privileges.
+	ContainerSecurityProfileRestricted = "restricted"
+)
+
+// ContainerSecurityProfile defines the docker run options and the
+// host mounts of container runnables.
+type ContainerSecurityProfile struct {
+	// Options are the docker run options (like "--network=host")
+	Options []string
+	// Volumes are the host mounts in docker format (host:container)
+	Volumes []string
+}
+
+var containerSecurityProfiles = map[string]ContainerSecurityProfile{
+	ContainerSecurityProfileMPI: {
+		Options: []string{"--network=host", "--ipc=host", "--pid=host",
+			"--privileged", "--uts=host"},
+		Volumes: []string{
+			"/etc/cloudbatch-taskgroup-hosts:/etc/cloudbatch-taskgroup-hosts",
+			"/etc/ssh:/etc/ssh",
+			"/root/.ssh:/root/.ssh",
+		},
+	},
+	ContainerSecurityProfileDefault: {
+		Options: []string{"--network=host"},
+		Volumes: []string{
+			"/etc/cloudbatch-taskgroup-hosts:/etc/cloudbatch-taskgroup-hosts",
+		},
+	},
+	ContainerSecurityProfileRestricted: {
+		Options: []string{"--security-opt=no-new-privileges"},
+		Volumes: []string{},
+	},
+}
+
+// GetContainerSecurityProfile returns the container security profile
+// with the given name. If the name is empty the MPI profile is returned.
+func GetContainerSecurityProfile(name string) (ContainerSecurityProfile, error) {
+	if name == "" {
+		name = ContainerSecurityProfileMPI
+	}
+	profile, exists := containerSecurityProfiles[name]
+	if !exists {
+		return ContainerSecurityProfile{},
+			fmt.Errorf("unknown container security profile: %s", name)
+	}
+	// return a copy so that the profile cannot be modified
+	return ContainerSecurityProfile{
+		Options: append([]string{}, profile.Options...),
+		Volumes: append([]string{}, profile.Volumes...),
+	}, nil
+}
+
+// ContainerOptions returns the docker run options of the profile. If
+// the external network is blocked the network options are removed.
+func (p ContainerSecurityProfile) ContainerOptions(blockExternalNetwork bool) string {
+	options := make([]string, 0, len(p.Options))
+	for _, option := range p.Options {
+		if blockExternalNetwork && strings.HasPrefix(option, "--network") {
+			continue
+		}
+		options = append(options, option)
+	}
+	return strings.Join(options, " ")
+}
+
+func SetContainerSecurityProfileExtension(jt drmaa2interface.JobTemplate, profile string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionContainerSecurityProfile] = profile
+	return jt
+}
+
+func GetContainerSecurityProfileExtension(jt drmaa2interface.JobTemplate) (string, bool) {
+	if jt.ExtensionList == nil {
+		return "", false
+	}
+	extension, hasExtension := jt.ExtensionList[ExtensionContainerSecurityProfile]
+	return extension, hasExtension
+}
+
+// SetContainerSecurityProfile sets the container security profile
+// which is used for all jobs which do not set the profile in the
+// job template extension. By default the MPI profile is used.
+func (t *GCPBatchTracker) SetContainerSecurityProfile(profile string) error {
+	if _, err := GetContainerSecurityProfile(profile); err != nil {
+		return err
+	}
+	t.containerSecurityProfile = profile
+	return nil
+}
+
+// applyContainerSecurityProfile sets the container security profile
+// of the tracker in the job template if the job template does not
+// define one.
+func (t *GCPBatchTracker) applyContainerSecurityProfile(jt drmaa2interface.JobTemplate) drmaa2interface.JobTemplate {
+	if t.containerSecurityProfile == "" {
+		return jt
+	}
+	if _, exists := GetContainerSecurityProfileExtension(jt); exists {
+		return jt
+	}
+	// don't modify the extension list of the caller
+	extensions := make(map[string]string, len(jt.ExtensionList)+1)
+	for k, v := range jt.ExtensionList {
+		extensions[k] = v
+	}
+	jt.ExtensionList = extensions
+	return SetContainerSecurityProfileExtension(jt, t.containerSecurityProfile)
+}
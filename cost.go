@@ -0,0 +1,385 @@
+package gcpbatchtracker
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+// pricesCSV is the default price table (see PriceTable).
+//
+//go:embed prices.csv
+var pricesCSV string
+
+const (
+	// basePriceRegion is the region of which the prices are used
+	// for regions which have no own prices
+	basePriceRegion = "us-central1"
+	// hoursPerMonth converts the monthly disk prices to hourly prices
+	hoursPerMonth = 730
+	// defaultBootDiskGB is the boot disk size Google Batch uses when
+	// it is not set
+	defaultBootDiskGB = 30
+	// defaultDiskType is the disk type Google Batch uses when it is
+	// not set
+	defaultDiskType = "pd-balanced"
+	// localSSDGB is the size of one local SSD partition; local SSD
+	// disks are sized in multiples of it
+	localSSDGB = 375
+)
+
+// Kinds of prices in the price table
+const (
+	PriceKindCPU     = "cpu"
+	PriceKindMemory  = "memory"
+	PriceKindMachine = "machine"
+	PriceKindGPU     = "gpu"
+	PriceKindDisk    = "disk"
+	PriceKindFactor  = "factor"
+)
+
+// Price is the price for standard and spot VMs.
+type Price struct {
+	Standard float64
+	Spot     float64
+}
+
+// PriceTable contains the Compute Engine prices per region in USD. The
+// "cpu" price is per vCPU hour and the "memory" price per GiB hour of a
+// machine family (like "n2"), the "machine" price per hour of a machine
+// type (like "f1-micro"), the "gpu" price per GPU hour, and the "disk"
+// price per GB month. Regions without own prices use the us-central1
+// prices multiplied by the "factor" of the region.
+type PriceTable struct {
+	prices map[string]Price
+}
+
+var (
+	priceTableMutex sync.RWMutex
+	priceTable      = mustParsePriceTable(pricesCSV)
+)
+
+func mustParsePriceTable(table string) *PriceTable {
+	prices, err := ParsePriceTable(strings.NewReader(table))
+	if err != nil {
+		panic(fmt.Sprintf("invalid price table: %v", err))
+	}
+	return prices
+}
+
+// ParsePriceTable reads a price table in CSV format with the columns
+// region, kind, name, standard price, and spot price.
+func ParsePriceTable(r io.Reader) (*PriceTable, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	table := &PriceTable{prices: make(map[string]Price, len(records))}
+	for _, record := range records {
+		var price Price
+		for i, value := range []*float64{&price.Standard, &price.Spot} {
+			if *value, err = strconv.ParseFloat(record[i+3], 64); err != nil {
+				return nil, fmt.Errorf("invalid price in %v: %v", record, err)
+			}
+		}
+		table.prices[priceKey(record[0], record[1], record[2])] = price
+	}
+	return table, nil
+}
+
+// LoadPriceTable reads a price table from a CSV file (see
+// ParsePriceTable()).
+func LoadPriceTable(file string) (*PriceTable, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open price table %s: %v", file, err)
+	}
+	defer f.Close()
+	table, err := ParsePriceTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse price table %s: %v", file, err)
+	}
+	return table, nil
+}
+
+// SetPriceTable replaces the price table which is used for all cost
+// calculations (like with current or negotiated prices).
+func SetPriceTable(table *PriceTable) {
+	priceTableMutex.Lock()
+	defer priceTableMutex.Unlock()
+	priceTable = table
+}
+
+// GetPriceTable returns the price table which is used for all cost
+// calculations.
+func GetPriceTable() *PriceTable {
+	priceTableMutex.RLock()
+	defer priceTableMutex.RUnlock()
+	return priceTable
+}
+
+func priceKey(region, kind, name string) string {
+	return region + "/" + kind + "/" + name
+}
+
+// Lookup returns the price of the given kind in the region.
+func (p *PriceTable) Lookup(region, kind, name string) (Price, bool) {
+	if price, exists := p.prices[priceKey(region, kind, name)]; exists {
+		return price, true
+	}
+	factor, exists := p.prices[priceKey(region, PriceKindFactor, "")]
+	if !exists {
+		return Price{}, false
+	}
+	price, exists := p.prices[priceKey(basePriceRegion, kind, name)]
+	if !exists {
+		return Price{}, false
+	}
+	return Price{
+		Standard: price.Standard * factor.Standard,
+		Spot:     price.Spot * factor.Spot,
+	}, true
+}
+
+func (p *PriceTable) hourly(region, kind, name string, spot bool) (float64, error) {
+	price, exists := p.Lookup(region, kind, name)
+	if !exists {
+		return 0, fmt.Errorf("no %s price for %s in %s", kind, name, region)
+	}
+	if spot {
+		return price.Spot, nil
+	}
+	return price.Standard, nil
+}
+
+// machineFamily returns the family of a machine type ("n1" for custom
+// machine types without family like "custom-4-8192"). Custom machine
+// types are priced like the predefined machine types of the family.
+func machineFamily(machine string) string {
+	family := strings.Split(machine, "-")[0]
+	if family == "custom" {
+		return "n1"
+	}
+	return family
+}
+
+// MachinePrice returns the price per hour of a VM of the machine type
+// in the region including built-in GPUs.
+func (p *PriceTable) MachinePrice(region, machine string, spot bool) (float64, error) {
+	if _, exists := p.Lookup(region, PriceKindMachine, machine); exists {
+		return p.hourly(region, PriceKindMachine, machine, spot)
+	}
+	m, known := GetMachineType(machine)
+	if !known {
+		return 0, fmt.Errorf("unknown machine type %s", machine)
+	}
+	family := machineFamily(machine)
+	cpu, err := p.hourly(region, PriceKindCPU, family, spot)
+	if err != nil {
+		return 0, err
+	}
+	memory, err := p.hourly(region, PriceKindMemory, family, spot)
+	if err != nil {
+		return 0, err
+	}
+	price := float64(m.CPUs)*cpu + float64(m.MemoryMiB)/1024*memory
+	if m.GPUs > 0 {
+		gpu, err := p.hourly(region, PriceKindGPU, m.GPUType, spot)
+		if err != nil {
+			return 0, err
+		}
+		price += float64(m.GPUs) * gpu
+	}
+	return price, nil
+}
+
+// Cost is the cost of a job in USD.
+type Cost struct {
+	// VMs is the amount of VMs which run at the same time
+	VMs int64
+	// Runtime is the run duration of the job
+	Runtime time.Duration
+	// Machines is the cost of the VMs (including built-in GPUs)
+	Machines float64
+	// Accelerators is the cost of the attached GPUs
+	Accelerators float64
+	// Disks is the cost of the boot disks and attached disks
+	Disks float64
+	// Total is the sum of the cost of the machines, accelerators, and
+	// disks
+	Total float64
+}
+
+// JobCost calculates the cost of a Google Batch job in the region which
+// runs for the given time. It is assumed that the VMs of all task groups
+// run during the whole runtime. The amount of VMs is derived from the
+// task count, the parallelism, and the tasks per node of the task
+// groups. The cost of jobs using instance templates is unknown.
+func (p *PriceTable) JobCost(region string, job *batchpb.Job, runtime time.Duration) (Cost, error) {
+	cost := Cost{Runtime: runtime}
+	instances := job.GetAllocationPolicy().GetInstances()
+	if len(instances) == 0 {
+		return cost, fmt.Errorf("job has no instance policy")
+	}
+	// Google Batch only supports instances[0]
+	policy := instances[0].GetPolicy()
+	if policy == nil {
+		return cost, fmt.Errorf("cost of instance templates is unknown")
+	}
+	spot := policy.ProvisioningModel == batchpb.AllocationPolicy_SPOT ||
+		policy.ProvisioningModel == batchpb.AllocationPolicy_PREEMPTIBLE
+	hours := runtime.Hours()
+	for _, group := range job.GetTaskGroups() {
+		vms := groupVMs(group)
+		cost.VMs += vms
+
+		machine, err := p.MachinePrice(region, policy.MachineType, spot)
+		if err != nil {
+			return cost, err
+		}
+		cost.Machines += float64(vms) * hours * machine
+
+		for _, accelerator := range policy.GetAccelerators() {
+			gpu, err := p.hourly(region, PriceKindGPU, accelerator.Type, spot)
+			if err != nil {
+				return cost, err
+			}
+			cost.Accelerators += float64(vms) * hours * float64(accelerator.Count) * gpu
+		}
+
+		disks, err := p.diskPrice(region, group, policy, spot)
+		if err != nil {
+			return cost, err
+		}
+		cost.Disks += float64(vms) * hours * disks
+	}
+	cost.Total = cost.Machines + cost.Accelerators + cost.Disks
+	return cost, nil
+}
+
+// groupVMs returns the amount of VMs which run the tasks of the task
+// group at the same time.
+func groupVMs(group *batchpb.TaskGroup) int64 {
+	tasks := group.GetTaskCount()
+	if tasks < 1 {
+		tasks = 1
+	}
+	if parallelism := group.GetParallelism(); parallelism > 0 && parallelism < tasks {
+		tasks = parallelism
+	}
+	tasksPerNode := group.GetTaskCountPerNode()
+	if tasksPerNode < 1 {
+		tasksPerNode = 1
+	}
+	return (tasks + tasksPerNode - 1) / tasksPerNode
+}
+
+// diskPrice returns the price per hour of the boot disk and the
+// attached disks of one VM. Local SSDs are priced per started 375 GB
+// partition (at least one). Persistent disks without size (created from
+// an image or snapshot with its size) are not included.
+func (p *PriceTable) diskPrice(region string, group *batchpb.TaskGroup, policy *batchpb.AllocationPolicy_InstancePolicy, spot bool) (float64, error) {
+	bootDiskGB := int64(defaultBootDiskGB)
+	if mib := group.GetTaskSpec().GetComputeResource().GetBootDiskMib(); mib > 0 {
+		bootDiskGB = (mib + 1023) / 1024
+	}
+	bootDiskType := defaultDiskType
+	if bootDisk := policy.GetBootDisk(); bootDisk != nil {
+		if bootDisk.SizeGb > 0 {
+			bootDiskGB = bootDisk.SizeGb
+		}
+		if bootDisk.Type != "" {
+			bootDiskType = bootDisk.Type
+		}
+	}
+	disks := []*batchpb.AllocationPolicy_Disk{{Type: bootDiskType, SizeGb: bootDiskGB}}
+	for _, attached := range policy.GetDisks() {
+		if disk := attached.GetNewDisk(); disk != nil {
+			disks = append(disks, disk)
+		}
+	}
+	var price float64
+	for _, disk := range disks {
+		diskType := disk.Type
+		if diskType == "" {
+			diskType = defaultDiskType
+		}
+		monthly, err := p.hourly(region, PriceKindDisk, diskType, spot)
+		if err != nil {
+			return 0, err
+		}
+		size := disk.SizeGb
+		if diskType == "local-ssd" {
+			size = (size + localSSDGB - 1) / localSSDGB * localSSDGB
+			if size == 0 {
+				size = localSSDGB
+			}
+		}
+		price += float64(size) * monthly / hoursPerMonth
+	}
+	return price, nil
+}
+
+// EstimateCost returns the expected cost of the job when it runs for
+// the expected runtime in the location of the tracker.
+func (t *GCPBatchTracker) EstimateCost(jt drmaa2interface.JobTemplate, expectedRuntime time.Duration) (Cost, error) {
+	req, _, err := t.PlanJob(jt)
+	if err != nil {
+		return Cost{}, err
+	}
+	return GetPriceTable().JobCost(t.location, req.Job, expectedRuntime)
+}
+
+// JobCost returns the cost of the job based on the run duration of the
+// job.
+func (t *GCPBatchTracker) JobCost(jobID string) (Cost, error) {
+	job, err := t.getJob(jobID)
+	if err != nil {
+		return Cost{}, fmt.Errorf("could not get job %s: %w", jobID, err)
+	}
+	return BatchJobCost(job)
+}
+
+// addCost stores the cost of the job in the job info if the job has a
+// run duration and its cost is known.
+func addCost(job *batchpb.Job, ji drmaa2interface.JobInfo) drmaa2interface.JobInfo {
+	if ji.WallclockTime <= 0 {
+		return ji
+	}
+	cost, err := BatchJobCost(job)
+	if err != nil {
+		return ji
+	}
+	if ji.ExtensionList == nil {
+		ji.ExtensionList = make(map[string]string)
+	}
+	ji.ExtensionList[ExtensionJobInfoCost] = FormatCost(cost.Total)
+	return ji
+}
+
+// BatchJobCost returns the cost of the job based on its run duration.
+func BatchJobCost(job *batchpb.Job) (Cost, error) {
+	location, err := LocationFromJobID(job.GetName())
+	if err != nil {
+		return Cost{}, err
+	}
+	return GetPriceTable().JobCost(location, job,
+		job.GetStatus().GetRunDuration().AsDuration())
+}
+
+// FormatCost formats the amount in USD with 4 decimal places.
+func FormatCost(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 4, 64)
+}
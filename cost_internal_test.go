@@ -0,0 +1,48 @@
+package gcpbatchtracker
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var _ = Describe("Cost internals", func() {
+
+	It("should add the cost to the job info", func() {
+		req, err := ConvertJobTemplateToJobRequest("", "p", "us-central1",
+			drmaa2interface.JobTemplate{
+				JobCategory:       "busybox",
+				CandidateMachines: []string{"e2-standard-4"},
+			})
+		Expect(err).To(BeNil())
+		job := req.Job
+		job.Name = "projects/p/locations/us-central1/jobs/job1"
+		job.Status = &batchpb.JobStatus{
+			State:       batchpb.JobStatus_SUCCEEDED,
+			RunDuration: durationpb.New(time.Hour),
+		}
+		tracker := &GCPBatchTracker{}
+		tracker.SetJobCacheTTL(DefaultJobCacheTTL)
+		tracker.jobs.put(job)
+
+		cost, err := tracker.JobCost(job.Name)
+		Expect(err).To(BeNil())
+		Expect(cost.Total).To(BeNumerically(">", 0))
+		ji, err := tracker.JobInfo(job.Name)
+		Expect(err).To(BeNil())
+		Expect(ji.ExtensionList).To(HaveKeyWithValue(ExtensionJobInfoCost,
+			FormatCost(cost.Total)))
+
+		// no cost without run duration
+		job.Status.RunDuration = nil
+		ji, err = tracker.JobInfo(job.Name)
+		Expect(err).To(BeNil())
+		Expect(ji.ExtensionList).NotTo(HaveKey(ExtensionJobInfoCost))
+	})
+
+})
@@ -0,0 +1,159 @@
+package gcpbatchtracker_test
+
+import (
+	"strings"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Cost", func() {
+
+	Context("Price table", func() {
+
+		It("should derive the prices of other regions", func() {
+			table := GetPriceTable()
+			base, exists := table.Lookup("us-central1", PriceKindCPU, "e2")
+			Expect(exists).To(BeTrue())
+			price, exists := table.Lookup("europe-west4", PriceKindCPU, "e2")
+			Expect(exists).To(BeTrue())
+			Expect(price.Standard).To(BeNumerically("~", base.Standard*1.1, 1e-9))
+			Expect(price.Spot).To(BeNumerically("<", price.Standard))
+			_, exists = table.Lookup("mars-north1", PriceKindCPU, "e2")
+			Expect(exists).To(BeFalse())
+		})
+
+		It("should calculate the price of machine types", func() {
+			table := GetPriceTable()
+			cpu, _ := table.Lookup("us-central1", PriceKindCPU, "e2")
+			memory, _ := table.Lookup("us-central1", PriceKindMemory, "e2")
+			price, err := table.MachinePrice("us-central1", "e2-standard-4", false)
+			Expect(err).To(BeNil())
+			Expect(price).To(BeNumerically("~", 4*cpu.Standard+16*memory.Standard, 1e-9))
+
+			micro, err := table.MachinePrice("us-central1", "f1-micro", false)
+			Expect(err).To(BeNil())
+			Expect(micro).To(BeNumerically("~", 0.0076, 1e-9))
+
+			// built-in GPU
+			gpu, _ := table.Lookup("us-central1", PriceKindGPU, "nvidia-tesla-a100")
+			a2, err := table.MachinePrice("us-central1", "a2-highgpu-1g", false)
+			Expect(err).To(BeNil())
+			Expect(a2).To(BeNumerically(">", gpu.Standard))
+
+			// custom machine types are priced like their family
+			n1CPU, _ := table.Lookup("us-central1", PriceKindCPU, "n1")
+			n1Memory, _ := table.Lookup("us-central1", PriceKindMemory, "n1")
+			custom, err := table.MachinePrice("us-central1", "custom-4-8192", false)
+			Expect(err).To(BeNil())
+			Expect(custom).To(BeNumerically("~", 4*n1CPU.Standard+8*n1Memory.Standard, 1e-9))
+
+			_, err = table.MachinePrice("us-central1", "unknown-machine", false)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should use a custom price table", func() {
+			table, err := ParsePriceTable(strings.NewReader(`
+us-central1,machine,e2-standard-4,1.0,0.5
+us-central1,disk,pd-balanced,0,0
+`))
+			Expect(err).To(BeNil())
+			defaultTable := GetPriceTable()
+			SetPriceTable(table)
+			defer SetPriceTable(defaultTable)
+			price, err := GetPriceTable().MachinePrice("us-central1", "e2-standard-4", true)
+			Expect(err).To(BeNil())
+			Expect(price).To(Equal(0.5))
+
+			_, err = ParsePriceTable(strings.NewReader("us-central1,cpu,e2,abc,1"))
+			Expect(err).To(HaveOccurred())
+		})
+
+	})
+
+	Context("Job cost", func() {
+
+		var job *batchpb.Job
+
+		BeforeEach(func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "busybox",
+				CandidateMachines: []string{"e2-standard-4"},
+				MinSlots:          2,
+				MaxSlots:          4,
+			}
+			jt = SetSpotExtension(jt, true)
+			jt = SetAcceleratorsExtension(jt, 1, "nvidia-tesla-t4")
+			req, _, err := (&GCPBatchTracker{}).PlanJob(jt)
+			Expect(err).To(BeNil())
+			job = req.Job
+			job.Name = "projects/p/locations/us-central1/jobs/job1"
+		})
+
+		It("should calculate the cost of the VMs running in parallel", func() {
+			table := GetPriceTable()
+			cost, err := table.JobCost("us-central1", job, 2*time.Hour)
+			Expect(err).To(BeNil())
+			Expect(cost.VMs).To(Equal(int64(2)))
+			machine, _ := table.MachinePrice("us-central1", "e2-standard-4", true)
+			Expect(cost.Machines).To(BeNumerically("~", 2*2*machine, 1e-9))
+			gpu, _ := table.Lookup("us-central1", PriceKindGPU, "nvidia-tesla-t4")
+			Expect(cost.Accelerators).To(BeNumerically("~", 2*2*gpu.Spot, 1e-9))
+			disk, _ := table.Lookup("us-central1", PriceKindDisk, "pd-balanced")
+			Expect(cost.Disks).To(BeNumerically("~", 2*2*50*disk.Standard/730, 1e-9))
+			Expect(cost.Total).To(BeNumerically("~",
+				cost.Machines+cost.Accelerators+cost.Disks, 1e-9))
+		})
+
+		It("should price local SSDs per started partition", func() {
+			table := GetPriceTable()
+			withoutDisks, err := table.JobCost("us-central1", job, time.Hour)
+			Expect(err).To(BeNil())
+			job.AllocationPolicy.Instances[0].GetPolicy().Disks = []*batchpb.AllocationPolicy_AttachedDisk{
+				{Attached: &batchpb.AllocationPolicy_AttachedDisk_NewDisk{
+					NewDisk: &batchpb.AllocationPolicy_Disk{Type: "local-ssd"}}},
+				{Attached: &batchpb.AllocationPolicy_AttachedDisk_NewDisk{
+					NewDisk: &batchpb.AllocationPolicy_Disk{Type: "local-ssd", SizeGb: 400}}},
+				// size of the image
+				{Attached: &batchpb.AllocationPolicy_AttachedDisk_NewDisk{
+					NewDisk: &batchpb.AllocationPolicy_Disk{Type: "pd-ssd"}}},
+			}
+			cost, err := table.JobCost("us-central1", job, time.Hour)
+			Expect(err).To(BeNil())
+			localSSD, _ := table.Lookup("us-central1", PriceKindDisk, "local-ssd")
+			Expect(cost.Disks - withoutDisks.Disks).To(BeNumerically("~",
+				2*(375+750)*localSSD.Spot/730, 1e-9))
+		})
+
+		It("should not calculate the cost of instance templates", func() {
+			job.AllocationPolicy.Instances[0].PolicyTemplate =
+				&batchpb.AllocationPolicy_InstancePolicyOrTemplate_InstanceTemplate{
+					InstanceTemplate: "template",
+				}
+			_, err := GetPriceTable().JobCost("us-central1", job, time.Hour)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should calculate the cost of finished jobs", func() {
+			job.Status = &batchpb.JobStatus{
+				State:       batchpb.JobStatus_SUCCEEDED,
+				RunDuration: durationpb.New(time.Hour),
+			}
+			cost, err := BatchJobCost(job)
+			Expect(err).To(BeNil())
+			Expect(cost.Runtime).To(Equal(time.Hour))
+			// only JobInfo() and JobInfos() calculate the cost
+			ji, err := BatchJobToJobInfo("p", job)
+			Expect(err).To(BeNil())
+			Expect(ji.ExtensionList).NotTo(HaveKey(ExtensionJobInfoCost))
+		})
+
+	})
+
+})
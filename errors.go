@@ -0,0 +1,173 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned by the tracker can be checked with errors.Is(). Errors
+// of the Google Batch API are classified and keep the original gRPC
+// status (status.Code() works on them).
+var (
+	// ErrJobNotFound is returned when the job does not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrNotInSession is returned when the job exists but is not in
+	// the job session of the tracker
+	ErrNotInSession = errors.New("job not found in job session")
+	// ErrUnsupportedOperation is returned for operations which are
+	// not supported by Google Batch (like suspending a job)
+	ErrUnsupportedOperation = errors.New("unsupported operation")
+	// ErrPermissionDenied is returned when the credentials are missing
+	// or have no permission for the operation
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrTransient is returned when the API is temporarily unavailable
+	// (after all retries)
+	ErrTransient = errors.New("transient error")
+)
+
+// apiError is a classified error of the Google Batch API.
+type apiError struct {
+	kind error
+	err  error
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.err)
+}
+
+func (e *apiError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// classifyError wraps errors of the Google Batch API so that they can
+// be checked with errors.Is() against the Err* errors.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *apiError
+	if errors.As(err, &classified) {
+		return err
+	}
+	var kind error
+	switch status.Code(err) {
+	case codes.NotFound:
+		kind = ErrJobNotFound
+	case codes.PermissionDenied, codes.Unauthenticated:
+		kind = ErrPermissionDenied
+	case codes.Unimplemented:
+		kind = ErrUnsupportedOperation
+	default:
+		if !isTransient(err) {
+			return err
+		}
+		kind = ErrTransient
+	}
+	return &apiError{kind: kind, err: err}
+}
+
+// isTransient returns true for errors of rate limited or temporarily
+// unavailable API calls which can be retried.
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.ResourceExhausted, codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// withRetry calls the API function and retries it on transient errors
+// with the backoff of the submission limits. The returned error is
+// classified.
+func (t *GCPBatchTracker) withRetry(ctx context.Context, call func() error) error {
+	limits := SubmissionLimits{}
+	if l := t.submissionLimiter(); l != nil {
+		limits = l.limits
+	}
+	for retry := 0; ; retry++ {
+		err := call()
+		if err == nil || !isTransient(err) || retry >= limits.MaxRetries {
+			return classifyError(err)
+		}
+		select {
+		case <-time.After(limits.Backoff(retry)):
+		case <-ctx.Done():
+			return classifyError(err)
+		}
+	}
+}
+
+// getJob returns the cached job or requests it and retries on
+// transient errors.
+func (t *GCPBatchTracker) getJob(jobID string) (*batchpb.Job, error) {
+	if job, cached := t.jobs.get(jobID); cached {
+		return job, nil
+	}
+	var job *batchpb.Job
+	ctx := context.Background()
+	err := t.withRetry(ctx, func() error {
+		var err error
+		job, err = t.client.GetJob(ctx, &batchpb.GetJobRequest{
+			Name: jobID,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.jobs.put(job)
+	return job, nil
+}
+
+// getSessionJob returns the (cached) job if it is in the job session
+// of the tracker. Otherwise ErrNotInSession is returned. Errors of the
+// job lookup are returned as they are.
+func (t *GCPBatchTracker) getSessionJob(jobID string) (*batchpb.Job, error) {
+	job, err := t.getJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if t.drmaa2session != "" && !IsInJobSession(t.drmaa2session, job) {
+		return nil, fmt.Errorf("%w: job %s is not in job session %s",
+			ErrNotInSession, jobID, t.drmaa2session)
+	}
+	return job, nil
+}
+
+// deleteJob deletes the job and retries on transient errors.
+func (t *GCPBatchTracker) deleteJob(jobID, reason string) error {
+	defer t.jobs.invalidate(jobID)
+	ctx := context.Background()
+	return t.withRetry(ctx, ignoreNotFoundOnRetry(func() error {
+		_, err := t.client.DeleteJob(ctx, &batchpb.DeleteJobRequest{
+			Name:   jobID,
+			Reason: reason,
+		})
+		return err
+	}))
+}
+
+// ignoreNotFoundOnRetry returns the call for withRetry() which treats
+// NotFound errors of retries as success: the failed call before (like
+// with DEADLINE_EXCEEDED) has already deleted the job.
+func ignoreNotFoundOnRetry(call func() error) func() error {
+	attempts := 0
+	return func() error {
+		attempts++
+		err := call()
+		if attempts > 1 && status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,143 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Errors internals", func() {
+
+	It("should classify gRPC status errors", func() {
+		Expect(classifyError(nil)).To(BeNil())
+		for code, kind := range map[codes.Code]error{
+			codes.NotFound:          ErrJobNotFound,
+			codes.PermissionDenied:  ErrPermissionDenied,
+			codes.Unauthenticated:   ErrPermissionDenied,
+			codes.Unimplemented:     ErrUnsupportedOperation,
+			codes.ResourceExhausted: ErrTransient,
+			codes.Unavailable:       ErrTransient,
+			codes.DeadlineExceeded:  ErrTransient,
+			codes.Aborted:           ErrTransient,
+		} {
+			err := classifyError(status.Error(code, "error"))
+			Expect(errors.Is(err, kind)).To(BeTrue(), code.String())
+			// the gRPC status is kept
+			Expect(status.Code(err)).To(Equal(code))
+			// classified errors are not wrapped again
+			Expect(classifyError(err)).To(BeIdenticalTo(err))
+		}
+		err := status.Error(codes.InvalidArgument, "invalid")
+		Expect(classifyError(err)).To(BeIdenticalTo(err))
+		// wrapped status errors
+		err = classifyError(fmt.Errorf("wrapped: %w", status.Error(codes.NotFound, "not found")))
+		Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+	})
+
+	It("should only treat rate limits and unavailability as transient", func() {
+		for _, code := range []codes.Code{codes.ResourceExhausted, codes.Unavailable,
+			codes.DeadlineExceeded, codes.Aborted} {
+			Expect(isTransient(status.Error(code, "error"))).To(BeTrue(), code.String())
+		}
+		for _, code := range []codes.Code{codes.OK, codes.NotFound, codes.InvalidArgument,
+			codes.AlreadyExists, codes.PermissionDenied, codes.Internal} {
+			Expect(isTransient(status.Error(code, "error"))).To(BeFalse(), code.String())
+		}
+		Expect(isTransient(errors.New("no status"))).To(BeFalse())
+	})
+
+	Context("Retries", func() {
+
+		var tracker *GCPBatchTracker
+
+		BeforeEach(func() {
+			tracker = &GCPBatchTracker{limiter: newSubmissionLimiter(SubmissionLimits{
+				MaxRetries:     3,
+				InitialBackoff: 10 * time.Millisecond,
+				MaxBackoff:     20 * time.Millisecond,
+			})}
+		})
+
+		// failing returns a call which fails with the errors before it
+		// succeeds
+		failing := func(attempts *int, errs ...error) func() error {
+			return func() error {
+				*attempts++
+				if *attempts <= len(errs) {
+					return errs[*attempts-1]
+				}
+				return nil
+			}
+		}
+
+		It("should retry transient errors with backoff", func() {
+			attempts := 0
+			unavailable := status.Error(codes.Unavailable, "unavailable")
+			start := time.Now()
+			err := tracker.withRetry(context.Background(),
+				failing(&attempts, unavailable, unavailable, unavailable))
+			Expect(err).To(BeNil())
+			Expect(attempts).To(Equal(4))
+			// 10ms + 20ms + 20ms
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		})
+
+		It("should give up after the max. retries", func() {
+			attempts := 0
+			quota := status.Error(codes.ResourceExhausted, "quota")
+			err := tracker.withRetry(context.Background(),
+				failing(&attempts, quota, quota, quota, quota, quota))
+			Expect(errors.Is(err, ErrTransient)).To(BeTrue())
+			Expect(attempts).To(Equal(4))
+		})
+
+		It("should not retry other errors", func() {
+			attempts := 0
+			err := tracker.withRetry(context.Background(),
+				failing(&attempts, status.Error(codes.NotFound, "not found")))
+			Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+			Expect(attempts).To(Equal(1))
+
+			// no retries without limiter
+			attempts = 0
+			err = (&GCPBatchTracker{}).withRetry(context.Background(),
+				failing(&attempts, status.Error(codes.Unavailable, "unavailable")))
+			Expect(errors.Is(err, ErrTransient)).To(BeTrue())
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("should stop retrying when the context is canceled", func() {
+			attempts := 0
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			unavailable := status.Error(codes.Unavailable, "unavailable")
+			err := tracker.withRetry(ctx, failing(&attempts, unavailable, unavailable))
+			Expect(errors.Is(err, ErrTransient)).To(BeTrue())
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("should treat a deleted job in a retry of the deletion as success", func() {
+			attempts := 0
+			err := tracker.withRetry(context.Background(), ignoreNotFoundOnRetry(
+				failing(&attempts, status.Error(codes.DeadlineExceeded, "deadline"),
+					status.Error(codes.NotFound, "not found"))))
+			Expect(err).To(BeNil())
+			Expect(attempts).To(Equal(2))
+
+			// but not in the first call
+			attempts = 0
+			err = tracker.withRetry(context.Background(), ignoreNotFoundOnRetry(
+				failing(&attempts, status.Error(codes.NotFound, "not found"))))
+			Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+		})
+
+	})
+
+})
@@ -0,0 +1,43 @@
+package gcpbatchtracker_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2os/pkg/jobtracker"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Errors", func() {
+
+	It("should return ErrUnsupportedOperation for unsupported job control actions", func() {
+		tracker := &GCPBatchTracker{}
+		for _, action := range []string{
+			jobtracker.JobControlSuspend,
+			jobtracker.JobControlResume,
+			jobtracker.JobControlHold,
+			jobtracker.JobControlRelease,
+		} {
+			err := tracker.JobControl("projects/p/locations/us-central1/jobs/job1", action)
+			Expect(errors.Is(err, ErrUnsupportedOperation)).To(BeTrue())
+			Expect(errors.Is(err, ErrJobNotFound)).To(BeFalse())
+		}
+	})
+
+	It("should return ErrJobNotFound for jobs in locations which are not managed", func() {
+		tracker, err := NewMultiLocationTrackerFromTrackers(map[string]*GCPBatchTracker{
+			"us-central1": {},
+		})
+		Expect(err).To(BeNil())
+		_, _, err = tracker.JobState("projects/p/locations/asia-east1/jobs/job1")
+		Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+		_, err = tracker.JobInfo("job1")
+		Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+		err = tracker.JobControl("projects/p/locations/us-central1/jobs/job1",
+			jobtracker.JobControlSuspend)
+		Expect(errors.Is(err, ErrUnsupportedOperation)).To(BeTrue())
+	})
+
+})
@@ -2,9 +2,8 @@ package gcpbatchtracker
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	batch "cloud.google.com/go/batch/apiv1"
@@ -12,8 +11,6 @@ import (
 	"github.com/dgruber/drmaa2interface"
 	"github.com/dgruber/drmaa2os/pkg/helper"
 	"github.com/dgruber/drmaa2os/pkg/jobtracker"
-	"github.com/patrickmn/go-cache"
-	"google.golang.org/api/iterator"
 )
 
 // GCPBatchTracker implements the JobTracker interface so that it can be
@@ -26,8 +23,33 @@ type GCPBatchTracker struct {
 	location string
 	// job session name
 	drmaa2session string
-	// cache for job info
-	jcache *cache.Cache
+	// cache for job snapshots
+	jobs jobCache
+	// container security profile used when not set in job template
+	containerSecurityProfile string
+	// storage backend and location of the job templates of new jobs
+	jobTemplateStorage         string
+	jobTemplateStorageLocation string
+	// strict validation of job templates which don't define it
+	strictValidation bool
+	// named presets of job template settings
+	queues      map[string]Queue
+	queuesMutex sync.RWMutex
+	// return existing jobs with the same JobName on submission
+	idempotentSubmission bool
+	// amount of jobs requested per ListJobs call (0 is the server default)
+	listJobsPageSize int32
+	// limits checked before a job is submitted
+	admissionPolicy *AdmissionPolicy
+	// throttling of the job submission
+	limiter      *submissionLimiter
+	limiterMutex sync.Mutex
+	// CreateJob call (the call of the client if nil)
+	createJobCall createJobFunc
+	// machine types available in the location
+	machines machineTypeCache
+	// owner of jobs which don't define one
+	jobOwner string
 }
 
 // NewGCPBatchTracker returns a new GCPBatchTracker instance which is used
@@ -44,54 +66,45 @@ func NewGCPBatchTracker(drmaa2session string, project, location string) (*GCPBat
 	if err != nil {
 		return nil, err
 	}
-	return &GCPBatchTracker{
-		client:        c,
+	return newGCPBatchTracker(c, drmaa2session, project, location), nil
+}
+
+// newGCPBatchTracker returns a GCPBatchTracker which uses the given
+// Google Batch client (which can be shared between locations).
+func newGCPBatchTracker(client *batch.Client, drmaa2session string, project, location string) *GCPBatchTracker {
+	t := &GCPBatchTracker{
+		client:        client,
 		project:       project,
 		location:      location,
 		drmaa2session: drmaa2session,
-		jcache:        cache.New(10*time.Second, 1*time.Minute),
-	}, nil
+		limiter:       newSubmissionLimiter(DefaultSubmissionLimits),
+		jobOwner:      currentUser(),
+	}
+	t.jobs.setTTL(DefaultJobCacheTTL)
+	return t
 }
 
 // ListJobs returns all visible job IDs or an error.
 func (t *GCPBatchTracker) ListJobs() ([]string, error) {
-	return listJobs(t, true)
+	return listJobs(t, true, nil)
 }
 
 // listJobs returns all visible job IDs or an error. If useJobSessionFilter
 // is true then only jobs which are in the same job session are returned.
-func listJobs(t *GCPBatchTracker, useJobSessionFilter bool) ([]string, error) {
+// If the filter is not nil only jobs matching the filter are returned
+// (DRMAA2 JobInfo filter semantics).
+func listJobs(t *GCPBatchTracker, useJobSessionFilter bool, filter *drmaa2interface.JobInfo) ([]string, error) {
 	jobs := make([]string, 0)
-	req := &batchpb.ListJobsRequest{
-		Parent: fmt.Sprintf("projects/%s/locations/%s", t.project, t.location),
+	req := t.listJobsRequest(useJobSessionFilter, filter)
+	req.PageSize = t.listJobsPageSize
+	batchJobs, err := t.listBatchJobs(req)
+	if err != nil {
+		return nil, err
 	}
-	iter := t.client.ListJobs(context.Background(), req)
-	for {
-		job, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		// filter for jobsession, if job session is "" then all jobs are returned
-		if useJobSessionFilter && t.drmaa2session != "" {
-			if job.Labels["drmaa2session"] != t.drmaa2session {
-				continue
-			}
-		}
-		jobs = append(jobs, job.Name)
-
-		// cache job info
-		ji, err := BatchJobToJobInfo(t.project, job)
-		if err != nil {
-			continue
-		}
-		jiJSON, err := json.Marshal(ji)
-		if err != nil {
-			continue
+	for _, job := range batchJobs {
+		if _, matches := t.matchJob(job, useJobSessionFilter, filter); matches {
+			jobs = append(jobs, job.Name)
 		}
-		t.jcache.Set(job.Name, jiJSON, cache.DefaultExpiration)
 	}
 	return jobs, nil
 }
@@ -112,19 +125,22 @@ func (t *GCPBatchTracker) ListArrayJobs(arrayjobID string) ([]string, error) {
 // limits.
 // On success the job ID (job name) is returned.
 func (t *GCPBatchTracker) AddJob(jt drmaa2interface.JobTemplate) (string, error) {
+	jt, err := t.prepareJobTemplate(jt)
+	if err != nil {
+		return "", err
+	}
 	req, err := ConvertJobTemplateToJobRequest(t.drmaa2session, t.project, t.location, jt)
 	if err != nil {
 		return "", err
 	}
+	if err := t.admitJob(req); err != nil {
+		return "", err
+	}
 	// do some init: in case the stage out bucket does not exist, create it
 	if err := CreateMissingStageOutBuckets(t.project, jt.StageOutFiles); err != nil {
 		return "", fmt.Errorf("could not create stage out buckets: %v", err)
 	}
-	job, err := t.client.CreateJob(context.Background(), req)
-	if err != nil {
-		return "", err
-	}
-	return job.Name, nil
+	return t.createJobWithJobTemplates(req)
 }
 
 // AddArrayJob makes a mass submission of jobs defined by the same job template.
@@ -149,48 +165,28 @@ func (t *GCPBatchTracker) AddArrayJob(jt drmaa2interface.JobTemplate, begin int,
 
 // JobState returns the DRMAA2 state and substate (free form string) of the job.
 func (t *GCPBatchTracker) JobState(jobID string) (drmaa2interface.JobState, string, error) {
-	// invalidate cache
-	t.jcache.Delete(jobID)
+	// always request the current state
+	t.jobs.invalidate(jobID)
 
-	job, err := t.client.GetJob(context.Background(), &batchpb.GetJobRequest{
-		Name: jobID,
-	})
+	job, err := t.getSessionJob(jobID)
 	if err != nil {
 		return drmaa2interface.Undetermined, "", err
 	}
-	if t.drmaa2session != "" {
-		if job.Labels["drmaa2session"] != t.drmaa2session {
-			return drmaa2interface.Undetermined, "", errors.New("job not found in job session")
-		}
-	}
 	return ConvertJobState(job)
 }
 
 // JobInfo returns the job status of a job in form of a JobInfo struct or an error.
 func (t *GCPBatchTracker) JobInfo(jobID string) (drmaa2interface.JobInfo, error) {
-
-	if ji, found := t.jcache.Get(jobID); found {
-		var jobInfo drmaa2interface.JobInfo
-		if err := json.Unmarshal(ji.([]byte), &jobInfo); err != nil {
-			fmt.Printf("could not unmarshal job info: %v", err)
-		}
-		return jobInfo, nil
-	}
-
-	job, err := t.client.GetJob(context.Background(),
-		&batchpb.GetJobRequest{
-			Name: jobID,
-		})
+	job, err := t.getSessionJob(jobID)
 	if err != nil {
 		return drmaa2interface.JobInfo{}, err
 	}
-	if t.drmaa2session != "" &&
-		!IsInDRMAA2Session(t.client, t.drmaa2session, jobID) {
-		return drmaa2interface.JobInfo{},
-			errors.New("job not found in job session")
-	}
 
-	return BatchJobToJobInfo(t.project, job)
+	ji, err := BatchJobToJobInfo(t.project, job)
+	if err != nil {
+		return ji, err
+	}
+	return t.addTaskRetries(job, addCost(job, ji)), nil
 }
 
 // JobControl sends a request to the backend to either "terminate", "suspend",
@@ -199,31 +195,24 @@ func (t *GCPBatchTracker) JobInfo(jobID string) (drmaa2interface.JobInfo, error)
 // only to constants representing the actions. When the request is not accepted
 // by the system the function must return an error.
 func (t *GCPBatchTracker) JobControl(jobID string, action string) error {
-	// invalidate cache
-	t.jcache.Delete(jobID)
-
 	switch action {
 	case jobtracker.JobControlSuspend:
-		return errors.New("unsupported operation")
+		return fmt.Errorf("%w: %s", ErrUnsupportedOperation, action)
 	case jobtracker.JobControlResume:
-		return errors.New("unsupported operation")
+		return fmt.Errorf("%w: %s", ErrUnsupportedOperation, action)
 	case jobtracker.JobControlHold:
 		// can a Google Batch job be put in hold?
-		return errors.New("unsupported operation")
+		return fmt.Errorf("%w: %s", ErrUnsupportedOperation, action)
 	case jobtracker.JobControlRelease:
 		// can a Google Batch job be released from hold?
-		return errors.New("unsupported operation")
+		return fmt.Errorf("%w: %s", ErrUnsupportedOperation, action)
 	case jobtracker.JobControlTerminate:
 		// TODO: that reaps the job and should be DeleteJob()
 		// any Google Batch equivalent?
-		if t.drmaa2session != "" && !IsInDRMAA2Session(t.client, t.drmaa2session, jobID) {
-			return errors.New("job not found in job session")
+		if _, err := t.getSessionJob(jobID); err != nil {
+			return err
 		}
-		_, err := t.client.DeleteJob(context.Background(), &batchpb.DeleteJobRequest{
-			Name:   jobID,
-			Reason: "job terminated by user",
-		})
-		return err
+		return t.deleteJob(jobID, "job terminated by user")
 	}
 	return fmt.Errorf("undefined job operation")
 }
@@ -233,11 +222,9 @@ func (t *GCPBatchTracker) JobControl(jobID string, action string) error {
 // error occured (like job was not found). In case of a timeout also an
 // error must be returned.
 func (t *GCPBatchTracker) Wait(jobID string, timeout time.Duration, state ...drmaa2interface.JobState) error {
-	if t.drmaa2session != "" && !IsInDRMAA2Session(t.client, t.drmaa2session, jobID) {
-		return errors.New("job not found in job session")
+	if _, err := t.getSessionJob(jobID); err != nil {
+		return err
 	}
-	// invalidate cache
-	t.jcache.Delete(jobID)
 	return helper.WaitForState(t, jobID, timeout, state...)
 }
 
@@ -248,19 +235,10 @@ func (t *GCPBatchTracker) Wait(jobID string, timeout time.Duration, state ...drm
 // job nil should be returned.
 func (t *GCPBatchTracker) DeleteJob(jobID string) error {
 	// here it does not need to be in an end state
-	if t.drmaa2session != "" && !IsInDRMAA2Session(t.client, t.drmaa2session, jobID) {
-		return fmt.Errorf("job not found in job session %s", t.drmaa2session)
+	if _, err := t.getSessionJob(jobID); err != nil {
+		return err
 	}
-
-	// invalidate cache
-	t.jcache.Delete(jobID)
-
-	_, err := t.client.DeleteJob(context.Background(),
-		&batchpb.DeleteJobRequest{
-			Name:   jobID,
-			Reason: "job deleted by user",
-		})
-	return err
+	return t.deleteJob(jobID, "job deleted by user")
 }
 
 // ListJobCategories returns a list of job categories which can be used in the
@@ -278,19 +256,28 @@ func (t *GCPBatchTracker) ListJobCategories() ([]string, error) {
 		"<container_image_name>"}, nil
 }
 
+// IsInDRMAA2Session returns true if the job is in the job session. It
+// returns false if the job can't be requested (see InDRMAA2Session() for
+// distinguishing errors from a different job session).
 func IsInDRMAA2Session(client *batch.Client, session string, jobID string) bool {
-	// job ID might be long or short
-	//name := strings.Split(jobID, "/")[len(strings.Split(jobID, "/"))-1]
+	inSession, _ := InDRMAA2Session(client, session, jobID)
+	return inSession
+}
+
+// InDRMAA2Session returns true if the job is in the job session or an
+// error if the job can't be requested (like ErrJobNotFound or
+// ErrTransient).
+func InDRMAA2Session(client *batch.Client, session string, jobID string) (bool, error) {
 	job, err := client.GetJob(context.Background(),
 		&batchpb.GetJobRequest{
 			Name: jobID,
 		})
 	if err != nil {
-		return false
+		return false, classifyError(err)
 	}
-	return IsInJobSession(session, job)
+	return IsInJobSession(session, job), nil
 }
 
 func IsInJobSession(session string, job *batchpb.Job) bool {
-	return job.Labels["drmaa2session"] == session
+	return job.Labels[LabelSession] == EncodeLabelValue(session)
 }
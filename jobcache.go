@@ -0,0 +1,137 @@
+package gcpbatchtracker
+
+import (
+	"sync"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+)
+
+// DefaultJobCacheTTL is the time a job snapshot is cached by new trackers.
+const DefaultJobCacheTTL = 10 * time.Second
+
+// JobCacheStats are the counters of the job cache of a tracker.
+type JobCacheStats struct {
+	// Hits is the amount of job lookups answered from the cache
+	Hits uint64
+	// Misses is the amount of job lookups which required a GetJob call
+	Misses uint64
+	// Invalidations is the amount of jobs removed from the cache
+	// because they were changed (like deleted) or refreshed
+	Invalidations uint64
+	// Entries is the amount of cached jobs
+	Entries int
+}
+
+// jobCacheEntry is a snapshot of a job.
+type jobCacheEntry struct {
+	job     *batchpb.Job
+	expires time.Time
+}
+
+// jobCache caches job snapshots by job name so that operations on a
+// job (and listings followed by job info requests) don't request the
+// same job multiple times. The cached jobs must not be modified. The
+// zero value caches nothing (see setTTL()).
+type jobCache struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	jobs      map[string]jobCacheEntry
+	nextPrune time.Time
+	stats     JobCacheStats
+}
+
+// setTTL sets the time the jobs are kept (0 disables caching) and
+// drops the cached jobs.
+func (c *jobCache) setTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ttl = ttl
+	c.jobs = make(map[string]jobCacheEntry)
+	c.nextPrune = time.Time{}
+}
+
+// get returns the cached job if it is not expired.
+func (c *jobCache) get(jobID string) (*batchpb.Job, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, exists := c.jobs[jobID]
+	if exists && time.Now().Before(entry.expires) {
+		c.stats.Hits++
+		return entry.job, true
+	}
+	if exists {
+		delete(c.jobs, jobID)
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+// contains returns true if the job is cached and not expired. It
+// doesn't count as a cache hit or miss.
+func (c *jobCache) contains(jobID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, exists := c.jobs[jobID]
+	return exists && time.Now().Before(entry.expires)
+}
+
+// put stores a snapshot of the job.
+func (c *jobCache) put(job *batchpb.Job) {
+	if c.ttl <= 0 || job == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	c.prune(now)
+	c.jobs[job.GetName()] = jobCacheEntry{job: job, expires: now.Add(c.ttl)}
+}
+
+// prune removes the expired jobs at most once per TTL.
+func (c *jobCache) prune(now time.Time) {
+	if now.Before(c.nextPrune) {
+		return
+	}
+	for jobID, entry := range c.jobs {
+		if !now.Before(entry.expires) {
+			delete(c.jobs, jobID)
+		}
+	}
+	c.nextPrune = now.Add(c.ttl)
+}
+
+// invalidate removes the job from the cache.
+func (c *jobCache) invalidate(jobID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, exists := c.jobs[jobID]; exists {
+		delete(c.jobs, jobID)
+		c.stats.Invalidations++
+	}
+}
+
+// statistics returns the counters of the cache.
+func (c *jobCache) statistics() JobCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.jobs)
+	return stats
+}
+
+// SetJobCacheTTL sets the time for which jobs are cached (see
+// DefaultJobCacheTTL). Jobs returned by ListJobs() and GetJob calls are
+// cached so that following JobInfo() calls don't request them again.
+// JobState() always requests the current state. Jobs created by the
+// tracker replace the cached job with the same job ID, deleted jobs are
+// removed from the cache. A TTL of 0 disables the cache. The cached jobs
+// are dropped.
+func (t *GCPBatchTracker) SetJobCacheTTL(ttl time.Duration) {
+	t.jobs.setTTL(ttl)
+}
+
+// JobCacheStats returns the counters of the job cache.
+func (t *GCPBatchTracker) JobCacheStats() JobCacheStats {
+	return t.jobs.statistics()
+}
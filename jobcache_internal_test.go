@@ -0,0 +1,72 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Job cache internals", func() {
+
+	req := &batchpb.CreateJobRequest{
+		Parent: "projects/p/locations/us-central1",
+		JobId:  "job1",
+		Job:    &batchpb.Job{},
+	}
+	jobName := req.Parent + "/jobs/" + req.JobId
+
+	It("should change the TTL while jobs are looked up", func() {
+		tracker := &GCPBatchTracker{}
+		tracker.jobs.put(&batchpb.Job{Name: jobName})
+		Expect(tracker.jobs.contains(jobName)).To(BeFalse())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				tracker.SetJobCacheTTL(time.Minute)
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			tracker.jobs.put(&batchpb.Job{Name: jobName})
+			tracker.jobs.get(jobName)
+		}
+		<-done
+		tracker.jobs.put(&batchpb.Job{Name: jobName})
+		Expect(tracker.jobs.contains(jobName)).To(BeTrue())
+
+		tracker.SetJobCacheTTL(0)
+		Expect(tracker.JobCacheStats().Entries).To(Equal(0))
+	})
+
+	It("should replace the cached job when it is created", func() {
+		tracker := &GCPBatchTracker{limiter: newSubmissionLimiter(SubmissionLimits{})}
+		tracker.SetJobCacheTTL(time.Minute)
+		stale := &batchpb.Job{Name: jobName, Uid: "deleted"}
+		tracker.jobs.put(stale)
+
+		tracker.createJobCall = func(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, error) {
+			return nil, status.Error(codes.InvalidArgument, "invalid")
+		}
+		_, err := tracker.createJobWithJobTemplates(req)
+		Expect(err).To(HaveOccurred())
+		Expect(tracker.jobs.contains(jobName)).To(BeFalse())
+
+		tracker.jobs.put(stale)
+		tracker.createJobCall = func(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, error) {
+			return &batchpb.Job{Name: jobName, Uid: "created"}, nil
+		}
+		_, err = tracker.createJobWithJobTemplates(req)
+		Expect(err).To(BeNil())
+		job, cached := tracker.jobs.get(jobName)
+		Expect(cached).To(BeTrue())
+		Expect(job.Uid).To(Equal("created"))
+	})
+
+})
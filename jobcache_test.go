@@ -0,0 +1,52 @@
+package gcpbatchtracker_test
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Job cache", func() {
+
+	It("should have no cached jobs when the cache is disabled", func() {
+		tracker := &GCPBatchTracker{}
+		Expect(tracker.JobCacheStats()).To(Equal(JobCacheStats{}))
+		tracker.SetJobCacheTTL(0)
+		Expect(tracker.JobCacheStats()).To(Equal(JobCacheStats{}))
+	})
+
+	It("should answer job info requests of listed jobs from the cache", func() {
+		if !credentialsCheck() {
+			Skip("Credentials not set")
+		}
+		tracker, err := NewGCPBatchTracker("",
+			os.Getenv("GCPBATCHTRACKER_PROJECT"),
+			os.Getenv("GCPBATCHTRACKER_LOCATION"))
+		Expect(err).To(BeNil())
+		tracker.SetJobCacheTTL(time.Minute)
+		jobs, err := tracker.ListJobs()
+		Expect(err).To(BeNil())
+		if len(jobs) == 0 {
+			Skip("No jobs in location")
+		}
+		Expect(tracker.JobCacheStats().Entries).To(BeNumerically(">=", len(jobs)))
+
+		_, err = tracker.JobInfo(jobs[0])
+		Expect(err).To(BeNil())
+		stats := tracker.JobCacheStats()
+		Expect(stats.Hits).To(BeNumerically("==", 1))
+		Expect(stats.Misses).To(BeNumerically("==", 0))
+
+		// the job state is always requested
+		_, _, err = tracker.JobState(jobs[0])
+		Expect(err).To(BeNil())
+		stats = tracker.JobCacheStats()
+		Expect(stats.Invalidations).To(BeNumerically("==", 1))
+		Expect(stats.Misses).To(BeNumerically("==", 1))
+	})
+
+})
@@ -0,0 +1,69 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+// batchJobStates are the Google Batch job states of a DRMAA2 job state
+// (see ConvertJobState()).
+var batchJobStates = map[drmaa2interface.JobState][]batchpb.JobStatus_State{
+	drmaa2interface.Undetermined: {batchpb.JobStatus_STATE_UNSPECIFIED},
+	drmaa2interface.Queued:       {batchpb.JobStatus_QUEUED, batchpb.JobStatus_SCHEDULED},
+	drmaa2interface.Running:      {batchpb.JobStatus_RUNNING, batchpb.JobStatus_DELETION_IN_PROGRESS},
+	drmaa2interface.Done:         {batchpb.JobStatus_SUCCEEDED},
+	drmaa2interface.Failed:       {batchpb.JobStatus_FAILED},
+}
+
+// BatchJobFilter converts the parts of a DRMAA2 JobInfo filter which
+// can be evaluated by Google Batch into a ListJobsRequest filter
+// expression: the job ID, the state, the submission time, and the
+// AccountingID (Annotation), QueueName, and JobOwner labels. All other
+// fields (like Slots or AllocatedMachines) must be filtered on the
+// client side. An empty string is returned if nothing can be filtered
+// by Google Batch. The SubmissionTime is a lower bound (like all DRMAA2
+// time filters). Jobs without the "drmaa2owner" label never match a
+// JobOwner filter.
+func BatchJobFilter(filter *drmaa2interface.JobInfo) string {
+	if filter == nil {
+		return ""
+	}
+	var expressions []string
+	if filter.ID != "" {
+		expressions = append(expressions, fmt.Sprintf("name=%q", filter.ID))
+	}
+	if states, exists := batchJobStates[filter.State]; exists {
+		stateExpressions := make([]string, 0, len(states))
+		for _, state := range states {
+			stateExpressions = append(stateExpressions,
+				fmt.Sprintf("status.state=%q", state.String()))
+		}
+		expression := strings.Join(stateExpressions, " OR ")
+		if len(stateExpressions) > 1 {
+			expression = "(" + expression + ")"
+		}
+		expressions = append(expressions, expression)
+	}
+	if !filter.SubmissionTime.IsZero() {
+		expressions = append(expressions, fmt.Sprintf("create_time>=%q",
+			filter.SubmissionTime.UTC().Format(time.RFC3339)))
+	}
+	for _, label := range []struct {
+		key   string
+		value string
+	}{
+		{LabelAccounting, filter.Annotation},
+		{LabelQueue, filter.QueueName},
+		{LabelOwner, filter.JobOwner},
+	} {
+		if label.value != "" {
+			expressions = append(expressions, fmt.Sprintf("labels.%s=%q",
+				label.key, EncodeLabelValue(label.value)))
+		}
+	}
+	return strings.Join(expressions, " AND ")
+}
@@ -0,0 +1,86 @@
+package gcpbatchtracker_test
+
+import (
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Job filter", func() {
+
+	Context("BatchJobFilter", func() {
+
+		It("should not filter without filter", func() {
+			Expect(BatchJobFilter(nil)).To(Equal(""))
+			filter := drmaa2interface.CreateJobInfo()
+			Expect(BatchJobFilter(&filter)).To(Equal(""))
+		})
+
+		It("should filter for the job state", func() {
+			filter := drmaa2interface.CreateJobInfo()
+			filter.State = drmaa2interface.Done
+			Expect(BatchJobFilter(&filter)).To(Equal(`status.state="SUCCEEDED"`))
+			filter.State = drmaa2interface.Queued
+			Expect(BatchJobFilter(&filter)).To(Equal(
+				`(status.state="QUEUED" OR status.state="SCHEDULED")`))
+			// no Google Batch job state
+			filter.State = drmaa2interface.Suspended
+			Expect(BatchJobFilter(&filter)).To(Equal(""))
+		})
+
+		It("should filter for the submission time and labels", func() {
+			filter := drmaa2interface.CreateJobInfo()
+			filter.SubmissionTime = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+			filter.Annotation = "Team A"
+			filter.QueueName = "gpu"
+			filter.JobOwner = "alice"
+			filter.Slots = 4
+			Expect(BatchJobFilter(&filter)).To(Equal(
+				`create_time>="2023-05-01T12:00:00Z" AND ` +
+					`labels.accounting="` + EncodeLabelValue("Team A") + `" AND ` +
+					`labels.drmaa2queue="gpu" AND labels.drmaa2owner="alice"`))
+		})
+
+		It("should filter for the job ID", func() {
+			filter := drmaa2interface.CreateJobInfo()
+			filter.ID = "projects/p/locations/l/jobs/job1"
+			Expect(BatchJobFilter(&filter)).To(Equal(
+				`name="projects/p/locations/l/jobs/job1"`))
+		})
+
+	})
+
+	It("should store the job owner as label", func() {
+		tracker := &GCPBatchTracker{}
+		jt := drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+		req, _, err := tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.Labels).NotTo(HaveKey(LabelOwner))
+
+		tracker.SetJobOwner("bob")
+		req, _, err = tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		Expect(jt.ExtensionList).To(BeNil())
+		Expect(req.Job.Labels).To(HaveKeyWithValue(LabelOwner, "bob"))
+
+		// the job template takes precedence
+		req, _, err = tracker.PlanJob(SetJobOwnerExtension(jt, "carol"))
+		Expect(err).To(BeNil())
+		Expect(req.Job.Labels).To(HaveKeyWithValue(LabelOwner, "carol"))
+
+		req.Job.Labels[LabelOwner] = EncodeLabelValue("Alice")
+		req.Job.Status = &batchpb.JobStatus{}
+		ji, err := BatchJobToJobInfo("project", req.Job)
+		Expect(err).To(BeNil())
+		Expect(ji.JobOwner).To(Equal("Alice"))
+	})
+
+})
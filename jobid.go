@@ -0,0 +1,100 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Google Batch job IDs must start with a lowercase letter, end with a
+// lowercase letter or digit, and can only contain lowercase letters,
+// digits, and "-" (at most 63 characters).
+var validJobID = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var invalidJobIDChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+const (
+	maxJobIDLength = 63
+	// jobIDPrefix is the prefix of generated job IDs and of sanitized
+	// job names which do not start with a letter
+	jobIDPrefix = "drmaa2"
+)
+
+// jobIDCounter makes generated job IDs unique within the process even
+// when no random numbers are available.
+var jobIDCounter uint64
+
+// SanitizeJobName returns a valid Google Batch job ID for the JobName.
+// Valid job names are returned unchanged. Otherwise the job name is
+// converted to lowercase, invalid characters are replaced by "-", and
+// a hash of the original job name is appended so that different job
+// names ("My Job", "my-job") don't result in the same job ID.
+func SanitizeJobName(name string) string {
+	if validJobID.MatchString(name) {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+
+	id := strings.Trim(invalidJobIDChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if id == "" || id[0] < 'a' || id[0] > 'z' {
+		id = strings.TrimSuffix(jobIDPrefix+"-"+id, "-")
+	}
+	if len(id)+len(suffix) > maxJobIDLength {
+		id = strings.TrimRight(id[:maxJobIDLength-len(suffix)], "-")
+	}
+	return id + suffix
+}
+
+// NewJobID returns a new unique job ID for jobs without JobName. It
+// consists of the "drmaa2" prefix, the submission time, and a random
+// part.
+func NewJobID() string {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Sprintf("%s-%d-%d", jobIDPrefix, time.Now().UnixNano(),
+			atomic.AddUint64(&jobIDCounter, 1))
+	}
+	return fmt.Sprintf("%s-%d-%s", jobIDPrefix, time.Now().Unix(),
+		hex.EncodeToString(random))
+}
+
+// SetIdempotentSubmission enables the idempotent job submission: when
+// a job with the same JobName already exists in the job session, its
+// job ID is returned instead of an error.
+func (t *GCPBatchTracker) SetIdempotentSubmission(idempotent bool) {
+	t.idempotentSubmission = idempotent
+}
+
+// createJob submits the job request within the submission limits and
+// returns the job ID. When a retried CreateJob call fails because the
+// job already exists, the job was created by the previous attempt.
+func (t *GCPBatchTracker) createJob(req *batchpb.CreateJobRequest) (string, error) {
+	job, retried, err := t.submitJob(context.Background(), req)
+	if err == nil {
+		t.jobs.put(job)
+		return job.Name, nil
+	}
+	if !(t.idempotentSubmission || retried) || status.Code(err) != codes.AlreadyExists {
+		return "", err
+	}
+	existing, getErr := t.getJob(req.Parent + "/jobs/" + req.JobId)
+	if getErr != nil {
+		return "", err
+	}
+	if t.drmaa2session != "" && !IsInJobSession(t.drmaa2session, existing) {
+		return "", fmt.Errorf("job %s already exists in a different job session: %v", req.JobId, err)
+	}
+	return existing.Name, nil
+}
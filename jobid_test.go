@@ -0,0 +1,72 @@
+package gcpbatchtracker_test
+
+import (
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Jobid", func() {
+
+	validJobID := "^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$"
+
+	It("should keep valid job names", func() {
+		for _, name := range []string{"a", "my-job", "job-1"} {
+			Expect(SanitizeJobName(name)).To(Equal(name))
+		}
+	})
+
+	It("should sanitize invalid job names", func() {
+		names := []string{"My Job", "my-job-", "my_job", "1job", "---", "",
+			"Übung", strings.Repeat("Long Job Name ", 10)}
+		ids := map[string]bool{}
+		for _, name := range names {
+			id := SanitizeJobName(name)
+			Expect(id).To(MatchRegexp(validJobID), name)
+			Expect(SanitizeJobName(name)).To(Equal(id))
+			ids[id] = true
+		}
+		Expect(ids).To(HaveLen(len(names)))
+		Expect(SanitizeJobName("My Job")).To(HavePrefix("my-job-"))
+		Expect(SanitizeJobName("1job")).To(HavePrefix("drmaa2-1job-"))
+	})
+
+	It("should generate unique job IDs concurrently", func() {
+		var mtx sync.Mutex
+		var wg sync.WaitGroup
+		ids := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id := NewJobID()
+				mtx.Lock()
+				ids[id] = true
+				mtx.Unlock()
+			}()
+		}
+		wg.Wait()
+		Expect(ids).To(HaveLen(100))
+		for id := range ids {
+			Expect(id).To(MatchRegexp(validJobID))
+		}
+	})
+
+	It("should use the sanitized job name as job ID", func() {
+		jt := drmaa2interface.JobTemplate{
+			JobName:           "Nightly Build #42",
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+		req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		Expect(req.JobId).To(Equal(SanitizeJobName("Nightly Build #42")))
+		Expect(req.JobId).To(HavePrefix("nightly-build-42-"))
+	})
+
+})
@@ -1,6 +1,7 @@
 package gcpbatchtracker
 
 import (
+	"encoding/json"
 	"errors"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ func BatchJobToJobInfo(project string, job *batchpb.Job) (drmaa2interface.JobInf
 	ji := drmaa2interface.JobInfo{
 		ID: job.Name,
 	}
+	ji.ExtensionList = make(map[string]string)
 
 	ji.SubmissionTime = job.CreateTime.AsTime()
 	if job.Status != nil {
@@ -23,10 +25,14 @@ func BatchJobToJobInfo(project string, job *batchpb.Job) (drmaa2interface.JobInf
 		ji.WallclockTime = job.Status.RunDuration.AsDuration()
 	}
 
-	ji.Annotation = job.Labels["accounting"]
+	ji.Annotation = accountingID(job)
+	ji.QueueName, _ = DecodeLabelValue(job.Labels[LabelQueue])
+	ji.JobOwner, _ = DecodeLabelValue(job.Labels[LabelOwner])
 
 	// job template: max slots
-	ji.Slots = job.TaskGroups[0].TaskCount
+	if groups := job.GetTaskGroups(); len(groups) > 0 {
+		ji.Slots = groups[0].TaskCount
+	}
 
 	if job.Status.State == batchpb.JobStatus_FAILED {
 		ji.ExitStatus = 1
@@ -34,18 +40,13 @@ func BatchJobToJobInfo(project string, job *batchpb.Job) (drmaa2interface.JobInf
 
 	ji.State, ji.SubState, _ = ConvertJobState(job)
 
-	ji.ExtensionList = make(map[string]string)
 	ji.ExtensionList[ExtensionJobInfoJobUID] = job.Uid
 
 	// store job template in extension
-	for _, group := range job.GetTaskGroups() {
-		if group.TaskSpec != nil && group.TaskSpec.Environment != nil &&
-			group.TaskSpec.Environment.Variables != nil {
-			value, exists := group.TaskSpec.Environment.Variables[EnvJobTemplate]
-			if exists {
-				ji.ExtensionList[ExtensionJobInfoJobTemplate] = value
-				break
-			}
+	for i := range job.GetTaskGroups() {
+		if value, exists := jobTemplateValue(job, i); exists {
+			ji.ExtensionList[ExtensionJobInfoJobTemplate] = value
+			break
 		}
 	}
 
@@ -87,3 +88,74 @@ func TimesFromStatusEvents(events []*batchpb.StatusEvent) (dispatchTime, finishT
 	}
 	return
 }
+
+// TaskRetryCounts returns an estimate of the amount of retries of each
+// task. Google Batch does not report retries, hence they are derived
+// from the status events: each change to RUNNING after the first one
+// is counted as retry. The map key is the task group name followed by
+// the task index (like "group0/1").
+func TaskRetryCounts(tasks []*batchpb.Task) map[string]int64 {
+	retries := make(map[string]int64, len(tasks))
+	for _, task := range tasks {
+		var runs int64
+		for _, event := range task.GetStatus().GetStatusEvents() {
+			if event.TaskState == batchpb.TaskStatus_RUNNING ||
+				(event.TaskState == batchpb.TaskStatus_STATE_UNSPECIFIED &&
+					strings.HasSuffix(event.Description, "to RUNNING")) {
+				runs++
+			}
+		}
+		if runs > 0 {
+			runs--
+		}
+		retries[taskKey(task.Name)] = runs
+	}
+	return retries
+}
+
+// taskKey converts the full task name into "<group>/<index>".
+func taskKey(taskName string) string {
+	parts := strings.Split(taskName, "/")
+	if len(parts) >= 3 && parts[len(parts)-2] == "tasks" {
+		return parts[len(parts)-3] + "/" + parts[len(parts)-1]
+	}
+	return taskName
+}
+
+// hasRetryPolicy returns true if tasks of the job can be retried.
+func hasRetryPolicy(job *batchpb.Job) bool {
+	for _, group := range job.GetTaskGroups() {
+		if group.GetTaskSpec().GetMaxRetryCount() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// addTaskRetries stores the retry attempts of all tasks of the job
+// in the job info extension list. It requires listing all tasks
+// hence it is only done for jobs which have a retry policy. The
+// retries are optional information: when the tasks can't be listed
+// the job info is returned without them.
+func (t *GCPBatchTracker) addTaskRetries(job *batchpb.Job, ji drmaa2interface.JobInfo) drmaa2interface.JobInfo {
+	if !hasRetryPolicy(job) {
+		return ji
+	}
+	var tasks []*batchpb.Task
+	for _, group := range job.GetTaskGroups() {
+		groupTasks, err := t.listTasks(group.Name)
+		if err != nil {
+			return ji
+		}
+		tasks = append(tasks, groupTasks...)
+	}
+	retries, err := json.Marshal(TaskRetryCounts(tasks))
+	if err != nil {
+		return ji
+	}
+	if ji.ExtensionList == nil {
+		ji.ExtensionList = make(map[string]string)
+	}
+	ji.ExtensionList[ExtensionJobInfoTaskRetries] = string(retries)
+	return ji
+}
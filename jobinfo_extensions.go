@@ -1,13 +1,24 @@
 package gcpbatchtracker
 
-import "github.com/dgruber/drmaa2interface"
+import (
+	"encoding/json"
+
+	"github.com/dgruber/drmaa2interface"
+)
 
 const (
 	// ExtensionJobInfoJobTemplate is the job template stored in the job info
-	// extension list as base64 encoded string
+	// extension list as base64 encoded string, as compressed string, or as
+	// reference to the stored job template (see GetJobTemplateFromEnv)
 	ExtensionJobInfoJobTemplate = "jobtemplate_base64"
 	// ExtensionJobInfoJobUID is the Google Batch internal job UID
 	ExtensionJobInfoJobUID = "uid"
+	// ExtensionJobInfoTaskRetries contains the amount of retries of each
+	// task as JSON encoded map (only for jobs with a retry policy)
+	ExtensionJobInfoTaskRetries = "task_retries"
+	// ExtensionJobInfoCost is the cost of the job in USD (see
+	// BatchJobCost(); only set by JobInfo() for jobs with a run duration)
+	ExtensionJobInfoCost = "cost"
 )
 
 // GetJobTemplateExtensionFromJobInfo returns the job template which is stored
@@ -21,7 +32,7 @@ func GetJobTemplateExtensionFromJobInfo(ji drmaa2interface.JobInfo) (drmaa2inter
 	if !hasExtension {
 		return drmaa2interface.JobTemplate{}, false
 	}
-	jobTemplate, err := GetJobTemplateFromBase64(jt)
+	jobTemplate, err := GetJobTemplateFromEnv(jt)
 	if err != nil {
 		return drmaa2interface.JobTemplate{}, false
 	}
@@ -41,3 +52,21 @@ func GetUIDExtensionFromJobInfo(ji drmaa2interface.JobInfo) (string, bool) {
 	}
 	return uid, true
 }
+
+// GetTaskRetriesExtensionFromJobInfo returns the amount of retries of
+// each task keyed by "<group>/<task index>" (like "group0/1"). If the
+// job info does not contain the task retries extension it returns false.
+func GetTaskRetriesExtensionFromJobInfo(ji drmaa2interface.JobInfo) (map[string]int64, bool) {
+	if ji.ExtensionList == nil {
+		return nil, false
+	}
+	value, hasExtension := ji.ExtensionList[ExtensionJobInfoTaskRetries]
+	if !hasExtension {
+		return nil, false
+	}
+	var retries map[string]int64
+	if err := json.Unmarshal([]byte(value), &retries); err != nil {
+		return nil, false
+	}
+	return retries, true
+}
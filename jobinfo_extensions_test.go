@@ -3,6 +3,8 @@ package gcpbatchtracker_test
 import (
 	"os"
 
+	"cloud.google.com/go/batch/apiv1/batchpb"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -57,6 +59,63 @@ var _ = Describe("JobinfoExtensions", func() {
 			Expect(uid).ToNot(Equal(""))
 		})
 
+		It("should report the slots and the machine type of the job", func() {
+			req, err := ConvertJobTemplateToJobRequest("session", "project", "location",
+				drmaa2interface.JobTemplate{
+					RemoteCommand:     "/worker",
+					JobCategory:       "ubuntu:18.04",
+					MinSlots:          2,
+					MaxSlots:          8,
+					CandidateMachines: []string{"c2-standard-60"},
+				})
+			Expect(err).To(BeNil())
+			req.Job.Status = &batchpb.JobStatus{State: batchpb.JobStatus_RUNNING}
+			ji, err := BatchJobToJobInfo("project", req.Job)
+			Expect(err).To(BeNil())
+			Expect(ji.Slots).To(Equal(int64(8)))
+			Expect(ji.AllocatedMachines).To(Equal([]string{"c2-standard-60"}))
+		})
+
+	})
+
+	Context("Task retries", func() {
+
+		It("should count the retries of each task", func() {
+			tasks := []*batchpb.Task{
+				{
+					Name: "projects/p/locations/l/jobs/j/taskGroups/group0/tasks/0",
+					Status: &batchpb.TaskStatus{
+						StatusEvents: []*batchpb.StatusEvent{
+							{TaskState: batchpb.TaskStatus_RUNNING},
+							{TaskState: batchpb.TaskStatus_FAILED},
+							{TaskState: batchpb.TaskStatus_RUNNING},
+							{TaskState: batchpb.TaskStatus_SUCCEEDED},
+						},
+					},
+				},
+				{
+					Name: "projects/p/locations/l/jobs/j/taskGroups/group0/tasks/1",
+					Status: &batchpb.TaskStatus{
+						StatusEvents: []*batchpb.StatusEvent{
+							{Description: "Task state is updated from ASSIGNED to RUNNING"},
+						},
+					},
+				},
+			}
+			retries := TaskRetryCounts(tasks)
+			Expect(retries).To(Equal(map[string]int64{"group0/0": 1, "group0/1": 0}))
+
+			ji := drmaa2interface.JobInfo{}
+			_, exists := GetTaskRetriesExtensionFromJobInfo(ji)
+			Expect(exists).To(BeFalse())
+			ji.ExtensionList = map[string]string{
+				ExtensionJobInfoTaskRetries: `{"group0/0":1}`,
+			}
+			retries, exists = GetTaskRetriesExtensionFromJobInfo(ji)
+			Expect(exists).To(BeTrue())
+			Expect(retries["group0/0"]).To(Equal(int64(1)))
+		})
+
 	})
 
 })
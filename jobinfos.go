@@ -0,0 +1,183 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+const (
+	// jobInfosListThreshold is the min. amount of uncached jobs for
+	// which JobInfos() lists the jobs instead of requesting each job
+	jobInfosListThreshold = 10
+	// jobInfosListChunkSize is the max. amount of job names in the
+	// filter of one ListJobs request of JobInfos()
+	jobInfosListChunkSize = 50
+	// jobInfosParallelism is the max. amount of parallel API calls of
+	// JobInfos()
+	jobInfosParallelism = 8
+)
+
+// JobInfosError is returned by JobInfos() when the job info of some
+// jobs could not be retrieved. It contains the error per job ID.
+type JobInfosError struct {
+	Errors map[string]error
+}
+
+func (e *JobInfosError) Error() string {
+	jobIDs := make([]string, 0, len(e.Errors))
+	for jobID := range e.Errors {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+	errs := make([]string, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		errs = append(errs, fmt.Sprintf("%s: %v", jobID, e.Errors[jobID]))
+	}
+	return fmt.Sprintf("could not get job info of %d jobs: %s",
+		len(jobIDs), strings.Join(errs, "; "))
+}
+
+// Unwrap returns the errors of all jobs so that errors.Is() can be
+// used (like for ErrJobNotFound).
+func (e *JobInfosError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// JobInfos returns the job infos of many jobs at once (like for
+// dashboards). When many of the jobs are not cached they are listed by
+// their names, otherwise the jobs are requested in parallel. Unlike
+// JobInfo() the job infos don't contain the task retries, which would
+// require to list the tasks of each job. The returned map contains the
+// job infos of all jobs which could be retrieved. If some jobs could not
+// be retrieved a *JobInfosError with the error per job ID is returned
+// as well.
+func (t *GCPBatchTracker) JobInfos(ids []string) (map[string]drmaa2interface.JobInfo, error) {
+	jobInfos := make(map[string]drmaa2interface.JobInfo, len(ids))
+	errs := make(map[string]error)
+
+	// when listing fails the jobs are requested one by one
+	listed, _ := t.listUncachedJobs(ids)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	jobIDs := make(chan string)
+	for i := 0; i < jobInfosParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jobID := range jobIDs {
+				ji, err := t.listedJobInfo(jobID, listed)
+				mutex.Lock()
+				if err != nil {
+					errs[jobID] = err
+				} else {
+					jobInfos[jobID] = ji
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, jobID := range ids {
+		if !seen[jobID] {
+			seen[jobID] = true
+			jobIDs <- jobID
+		}
+	}
+	close(jobIDs)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return jobInfos, &JobInfosError{Errors: errs}
+	}
+	return jobInfos, nil
+}
+
+// listedJobInfo returns the job info of the listed job or of the job
+// requested by getSessionJob() if it was not listed.
+func (t *GCPBatchTracker) listedJobInfo(jobID string, listed map[string]*batchpb.Job) (drmaa2interface.JobInfo, error) {
+	job, exists := listed[jobID]
+	if !exists {
+		var err error
+		if job, err = t.getSessionJob(jobID); err != nil {
+			return drmaa2interface.JobInfo{}, err
+		}
+	}
+	ji, err := BatchJobToJobInfo(t.project, job)
+	if err != nil {
+		return ji, err
+	}
+	return addCost(job, ji), nil
+}
+
+// listUncachedJobs lists the requested jobs in the location of the
+// tracker which are not cached when there are at least
+// jobInfosListThreshold of them. It returns the listed jobs of the job
+// session.
+func (t *GCPBatchTracker) listUncachedJobs(ids []string) (map[string]*batchpb.Job, error) {
+	var names []string
+	seen := make(map[string]bool, len(ids))
+	for _, jobID := range ids {
+		if location, err := LocationFromJobID(jobID); err != nil || location != t.location {
+			continue
+		}
+		if !seen[jobID] && !t.jobs.contains(jobID) {
+			seen[jobID] = true
+			names = append(names, jobID)
+		}
+	}
+	if len(names) < jobInfosListThreshold {
+		return nil, nil
+	}
+	listed := make(map[string]*batchpb.Job, len(names))
+	for _, filter := range jobNameFilters(names, jobInfosListChunkSize) {
+		req := t.listJobsRequest(true, nil)
+		if req.Filter != "" {
+			req.Filter += " AND "
+		}
+		req.Filter += filter
+		req.PageSize = t.listJobsPageSize
+		jobs, err := t.listBatchJobs(req)
+		if err != nil {
+			return listed, err
+		}
+		for _, job := range jobs {
+			if t.drmaa2session != "" && !IsInJobSession(t.drmaa2session, job) {
+				continue
+			}
+			if seen[job.GetName()] {
+				listed[job.GetName()] = job
+				t.jobs.put(job)
+			}
+		}
+	}
+	return listed, nil
+}
+
+// jobNameFilters returns ListJobs filter expressions which match the
+// jobs with the given names (like `(name="a" OR name="b")`). Each
+// expression contains at most chunkSize names.
+func jobNameFilters(names []string, chunkSize int) []string {
+	var filters []string
+	for start := 0; start < len(names); start += chunkSize {
+		end := start + chunkSize
+		if end > len(names) {
+			end = len(names)
+		}
+		expressions := make([]string, 0, end-start)
+		for _, name := range names[start:end] {
+			expressions = append(expressions, fmt.Sprintf("name=%q", name))
+		}
+		filters = append(filters, "("+strings.Join(expressions, " OR ")+")")
+	}
+	return filters
+}
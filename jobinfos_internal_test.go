@@ -0,0 +1,83 @@
+package gcpbatchtracker
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+var _ = Describe("Job infos internals", func() {
+
+	newJob := func(session, name string) *batchpb.Job {
+		req, err := ConvertJobTemplateToJobRequest(session, "p", "us-central1",
+			SetMaxRetryCountExtension(drmaa2interface.JobTemplate{
+				JobName:           name,
+				JobCategory:       "busybox",
+				CandidateMachines: []string{"e2-standard-4"},
+			}, 3))
+		Expect(err).To(BeNil())
+		req.Job.Name = req.Parent + "/jobs/" + req.JobId
+		req.Job.Status = &batchpb.JobStatus{State: batchpb.JobStatus_RUNNING}
+		return req.Job
+	}
+
+	It("should filter for the job names in chunks", func() {
+		Expect(jobNameFilters(nil, 2)).To(BeEmpty())
+		filters := jobNameFilters([]string{"a", "b", "c", "d", "e"}, 2)
+		Expect(filters).To(Equal([]string{
+			`(name="a" OR name="b")`,
+			`(name="c" OR name="d")`,
+			`(name="e")`,
+		}))
+	})
+
+	It("should not list the jobs when less than the threshold are uncached", func() {
+		tracker := &GCPBatchTracker{location: "us-central1"}
+		tracker.SetJobCacheTTL(DefaultJobCacheTTL)
+		var ids []string
+		for i := 0; i < jobInfosListThreshold; i++ {
+			job := newJob("", fmt.Sprintf("job%d", i))
+			tracker.jobs.put(job)
+			ids = append(ids, job.Name,
+				fmt.Sprintf("projects/p/locations/europe-west4/jobs/job%d", i))
+		}
+		// a job ID given twice counts once
+		uncached := "projects/p/locations/us-central1/jobs/uncached"
+		ids = append(ids, uncached, uncached)
+		listed, err := tracker.listUncachedJobs(ids)
+		Expect(err).To(BeNil())
+		Expect(listed).To(BeNil())
+	})
+
+	It("should return the job infos of the session jobs without task retries", func() {
+		tracker := &GCPBatchTracker{
+			project:       "p",
+			location:      "us-central1",
+			drmaa2session: "session",
+		}
+		tracker.SetJobCacheTTL(DefaultJobCacheTTL)
+		job1 := newJob("session", "job1")
+		job2 := newJob("session", "job2")
+		other := newJob("other", "job3")
+		for _, job := range []*batchpb.Job{job1, job2, other} {
+			tracker.jobs.put(job)
+		}
+		// the tasks of the jobs with retry policy are not listed
+		jobInfos, err := tracker.JobInfos([]string{job1.Name, job2.Name, job1.Name, other.Name})
+		Expect(jobInfos).To(HaveLen(2))
+		Expect(jobInfos[job1.Name].State).To(Equal(drmaa2interface.Running))
+		Expect(jobInfos[job1.Name].ExtensionList).NotTo(HaveKey(ExtensionJobInfoTaskRetries))
+		Expect(jobInfos[job2.Name].ID).To(Equal(job2.Name))
+
+		var jobInfosErr *JobInfosError
+		Expect(errors.As(err, &jobInfosErr)).To(BeTrue())
+		Expect(jobInfosErr.Errors).To(HaveLen(1))
+		Expect(errors.Is(jobInfosErr.Errors[other.Name], ErrNotInSession)).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,56 @@
+package gcpbatchtracker_test
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Job infos", func() {
+
+	It("should return no job infos for no jobs", func() {
+		jobInfos, err := (&GCPBatchTracker{}).JobInfos(nil)
+		Expect(err).To(BeNil())
+		Expect(jobInfos).To(BeEmpty())
+	})
+
+	It("should return the errors per job ID", func() {
+		tracker, err := NewMultiLocationTrackerFromTrackers(map[string]*GCPBatchTracker{
+			"us-central1": {},
+		})
+		Expect(err).To(BeNil())
+		jobInfos, err := tracker.JobInfos([]string{
+			"projects/p/locations/asia-east1/jobs/job1",
+			"job2",
+		})
+		Expect(jobInfos).To(BeEmpty())
+		var jobInfosErr *JobInfosError
+		Expect(errors.As(err, &jobInfosErr)).To(BeTrue())
+		Expect(jobInfosErr.Errors).To(HaveLen(2))
+		Expect(jobInfosErr.Errors).To(HaveKey("job2"))
+		Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("could not get job info of 2 jobs"))
+	})
+
+	It("should return the job infos of listed jobs", func() {
+		if !credentialsCheck() {
+			Skip("Credentials not set")
+		}
+		tracker, err := NewGCPBatchTracker("",
+			os.Getenv("GCPBATCHTRACKER_PROJECT"),
+			os.Getenv("GCPBATCHTRACKER_LOCATION"))
+		Expect(err).To(BeNil())
+		jobs, err := tracker.ListJobs()
+		Expect(err).To(BeNil())
+		unknown := "projects/p/locations/" +
+			os.Getenv("GCPBATCHTRACKER_LOCATION") + "/jobs/unknown"
+		jobInfos, err := tracker.JobInfos(append(jobs, unknown))
+		Expect(jobInfos).To(HaveLen(len(jobs)))
+		Expect(errors.Is(err, ErrJobNotFound)).To(BeTrue())
+	})
+
+})
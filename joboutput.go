@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"cloud.google.com/go/batch/apiv1/batchpb"
 	"cloud.google.com/go/logging/logadmin"
 	"google.golang.org/api/iterator"
 )
@@ -65,9 +64,7 @@ func GetJobOutput(projectID, jobUid string, limit int64) ([]string, error) {
 // JobInfo extension.
 // If lastNLines is 0 then all lines are returned.
 func (t *GCPBatchTracker) JobOutput(jobID string, lastNLines int64) ([]string, error) {
-	job, err := t.client.GetJob(context.Background(), &batchpb.GetJobRequest{
-		Name: jobID,
-	})
+	job, err := t.getJob(jobID)
 	if err != nil {
 		return nil, err
 	}
@@ -4,9 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math/rand"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +24,10 @@ const (
 	JobCategoryScript     = "$script$"     // treats RemoteCommand as script and ignores args
 	// Env variable name container job template
 	EnvJobTemplate = "DRMAA2_JOB_TEMPLATE"
+	// Env variable name containing the mount paths of the stage out
+	// buckets (JSON list) so that they can be distinguished from the
+	// stage in buckets when the job template is reconstructed
+	EnvStageOutFiles = "DRMAA2_STAGE_OUT_FILES"
 )
 
 const (
@@ -56,11 +59,10 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 	}
 
 	jobRequest.Parent = "projects/" + project + "/locations/" + location
-	jobRequest.JobId = jt.JobName
-	if jobRequest.JobId == "" {
-		rand.Seed(time.Now().UnixNano())
-		jobRequest.JobId = fmt.Sprintf("drmaa2-%d-%d",
-			time.Now().Unix(), rand.Int()%10000)
+	if jt.JobName != "" {
+		jobRequest.JobId = SanitizeJobName(jt.JobName)
+	} else {
+		jobRequest.JobId = NewJobID()
 	}
 
 	prolog, _ := GetMachinePrologExtension(jt)
@@ -70,7 +72,13 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 
 	epilog, _ := GetMachineEpilogExtension(jt)
 
-	tasksPerNode, _ := GetTasksPerNodeExtension(jt)
+	machine := jt.CandidateMachines[0]
+	_, _, tasksPerNode := taskResources(jt)
+	memoryMib := jt.MinPhysMemory
+	if memoryMib == 0 && tasksPerNode > 1 {
+		// share the machine memory between the tasks
+		memoryMib = DefaultTaskMemoryMiB(machine, tasksPerNode)
+	}
 
 	barries := true
 	// barrier seem to be only allowed for parallel jobs:
@@ -119,9 +127,9 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 						SecretVariables: secrets,
 					},
 					ComputeResource: &batchpb.ComputeResource{
-						CpuMilli:    DefaultCPUMilli(jt.CandidateMachines[0]),
+						CpuMilli:    DefaultTaskCPUMilli(machine, tasksPerNode),
 						BootDiskMib: defaultBootDiskMib,
-						MemoryMib:   jt.MinPhysMemory,
+						MemoryMib:   memoryMib,
 					},
 					//MaxRunDuration: ,
 					Runnables: CreateRunnables(barries, prolog),
@@ -129,35 +137,43 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 			},
 		},
 		AllocationPolicy: &batchpb.AllocationPolicy{
-			/*
-				Network: &batchpb.AllocationPolicy_NetworkPolicy{
-					NetworkInterfaces: []*batchpb.AllocationPolicy_NetworkInterface{
-						{
-							Network: "global/networks/default",
-						},
-				},
-			*/
 			Location: &batchpb.AllocationPolicy_LocationPolicy{
 				AllowedLocations: []string{},
 			},
-			Labels: map[string]string{
-				"origin":        "go-drmaa2",
-				"accounting":    jt.AccountingID,
-				"drmaa2session": session,
-			},
+			Labels: jobLabels(session, jt),
 		},
 		// job labels
-		Labels: map[string]string{
-			"origin":        "go-drmaa2",
-			"accounting":    jt.AccountingID,
-			"drmaa2session": session,
-		},
+		Labels: jobLabels(session, jt),
 		// default logging is cloud logging
 		LogsPolicy: &batchpb.LogsPolicy{
 			Destination: batchpb.LogsPolicy_CLOUD_LOGGING,
 		},
 	}
 
+	// VPC network of the VMs (otherwise the default network is used)
+	if network, subnetwork, exists := GetNetworkExtension(jt); exists {
+		jobRequest.Job.AllocationPolicy.Network = &batchpb.AllocationPolicy_NetworkPolicy{
+			NetworkInterfaces: []*batchpb.AllocationPolicy_NetworkInterface{
+				{
+					Network:    network,
+					Subnetwork: subnetwork,
+				},
+			},
+		}
+	}
+	if email, exists := GetServiceAccountExtension(jt); exists {
+		jobRequest.Job.AllocationPolicy.ServiceAccount = &batchpb.ServiceAccount{
+			Email: email,
+		}
+	}
+	if locations, exists := GetAllowedLocationsExtension(jt); exists {
+		for _, location := range locations {
+			jobRequest.Job.AllocationPolicy.Location.AllowedLocations = append(
+				jobRequest.Job.AllocationPolicy.Location.AllowedLocations,
+				allowedLocation(location))
+		}
+	}
+
 	// if epilog is set, add it to the job
 	if epilog != "" {
 		if barries {
@@ -189,22 +205,19 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 			})
 	}
 
-	// apply resource limits
+	// apply resource limits; invalid values are ignored (they are
+	// reported by JobTemplateWarnings() and rejected in strict mode)
 	if jt.ResourceLimits != nil {
 		rt, exists := jt.ResourceLimits[ResourceLimitRuntime]
 		if exists {
-			if maxRunDuration, err := time.ParseDuration(rt); err != nil {
-				log.Printf("Invalid max run duration: %s (%v)", rt, err)
-			} else {
+			if maxRunDuration, err := time.ParseDuration(rt); err == nil {
 				jobRequest.Job.TaskGroups[0].TaskSpec.MaxRunDuration = durationpb.New(maxRunDuration)
 			}
 		}
 		bootDiskMib, exists := jt.ResourceLimits[ResourceLimitBootDisk]
 		if exists {
 			bootdisk, err := strconv.ParseInt(bootDiskMib, 10, 64)
-			if err != nil {
-				log.Printf("Invalid boot disk size: %s (%v)", bootDiskMib, err)
-			} else {
+			if err == nil {
 				if jobRequest.Job.TaskGroups[0].TaskSpec.ComputeResource == nil {
 					jobRequest.Job.TaskGroups[0].TaskSpec.ComputeResource = &batchpb.ComputeResource{}
 				}
@@ -214,9 +227,7 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 		cpuMili, exists := jt.ResourceLimits[ResourceLimitCPUMilli]
 		if exists {
 			cpu, err := strconv.ParseInt(cpuMili, 10, 64)
-			if err != nil {
-				log.Printf("Invalid cpu milli: %s (%v)", cpuMili, err)
-			} else {
+			if err == nil {
 				if jobRequest.Job.TaskGroups[0].TaskSpec.ComputeResource == nil {
 					jobRequest.Job.TaskGroups[0].TaskSpec.ComputeResource = &batchpb.ComputeResource{}
 				}
@@ -225,14 +236,54 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 		}
 	}
 
+	// retries of failed tasks (like preempted spot VMs)
+	if retries, exists := GetMaxRetryCountExtension(jt); exists {
+		jobRequest.Job.TaskGroups[0].TaskSpec.MaxRetryCount = retries
+	}
+	if retryExitCodes, failExitCodes, exists := GetLifecyclePoliciesExtension(jt); exists {
+		jobRequest.Job.TaskGroups[0].TaskSpec.LifecyclePolicies =
+			CreateLifecyclePolicies(retryExitCodes, failExitCodes)
+	}
+
+	// compact placement for tightly coupled jobs
+	if collocation, maxDistance, exists := GetPlacementPolicyExtension(jt); exists {
+		jobRequest.Job.AllocationPolicy.Placement = &batchpb.AllocationPolicy_PlacementPolicy{
+			Collocation: collocation,
+			MaxDistance: maxDistance,
+		}
+	}
+
+	// boot disk extensions supersede the bootdiskmib resource limit
+	bootDiskImage, bootDiskType, bootDiskSizeGB, hasBootDisk := GetBootDiskExtension(jt)
+	if hasBootDisk && bootDiskSizeGB > 0 {
+		jobRequest.Job.TaskGroups[0].TaskSpec.ComputeResource.BootDiskMib = bootDiskSizeGB * 1024
+	}
+
 	// set executable
 	execPosition := 3
 	if !barries {
 		execPosition = 1
 	}
 
-	switch jt.JobCategory {
-	case JobCategoryScriptPath:
+	// custom runnables replace the default layout
+	customRunnables, hasCustomRunnables := GetRunnablesExtension(jt)
+	stageInVolumesStart := 0
+
+	switch {
+	case hasCustomRunnables:
+		runnables, err := ConvertRunnables(jt, customRunnables)
+		if err != nil {
+			return nil, err
+		}
+		jobRequest.Job.TaskGroups[0].TaskSpec.Runnables = runnables
+		// stage in files are mounted into the first container and
+		// later copied into all other containers
+		execPosition = 0
+		if positions := containerPositions(runnables); len(positions) > 0 {
+			execPosition = positions[0]
+			stageInVolumesStart = len(runnables[execPosition].GetContainer().Volumes)
+		}
+	case jt.JobCategory == JobCategoryScriptPath:
 		jobRequest.Job.TaskGroups[0].TaskSpec.Runnables[execPosition].
 			Executable = &batchpb.Runnable_Script_{
 			Script: &batchpb.Runnable_Script{
@@ -241,7 +292,7 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 				},
 			},
 		}
-	case JobCategoryScript:
+	case jt.JobCategory == JobCategoryScript:
 		jobRequest.Job.TaskGroups[0].TaskSpec.Runnables[execPosition].
 			Executable = &batchpb.Runnable_Script_{
 			Script: &batchpb.Runnable_Script{
@@ -252,40 +303,29 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 		}
 	default:
 		// is container image
-
-		// in case of a GPU job we need to add the --gpus all option
-		additionalOption := ""
-		if t, count, exists := GetAcceleratorsExtension(jt); exists &&
-			count > 0 && strings.HasPrefix(t, "nvidia") {
-			additionalOption = " --gpus all --device /dev/nvidiactl --device /dev/nvidia-uvm --device /dev/nvidia-uvm-tools"
-			for i := 0; i < int(count); i++ {
-				additionalOption += fmt.Sprintf(" --device /dev/nvidia%d", i)
-			}
+		container, err := CreateContainer(jt, jt.JobCategory, jt.RemoteCommand, jt.Args)
+		if err != nil {
+			return nil, err
 		}
-
 		jobRequest.Job.TaskGroups[0].TaskSpec.Runnables[execPosition].
 			Executable = &batchpb.Runnable_Container_{
-			Container: &batchpb.Runnable_Container{
-				ImageUri:   jt.JobCategory,
-				Username:   "",
-				Password:   "",
-				Entrypoint: jt.RemoteCommand,
-				Commands:   jt.Args,
-				Volumes: []string{
-					"/etc/cloudbatch-taskgroup-hosts:/etc/cloudbatch-taskgroup-hosts",
-					"/etc/ssh:/etc/ssh",
-					"/root/.ssh:/root/.ssh",
-					//"/etc/hosts:/etc/hosts",
-				},
-				Options: "--network=host --ipc=host --pid=host --privileged --uts=host" +
-					additionalOption,
-			},
+			Container: container,
 		}
-
 	}
 
 	dockerOptionsExtension, exists := GetDockerOptionsExtension(jt)
-	if exists {
+	if exists && hasCustomRunnables {
+		// override docker options of containers without own options
+		if !hasContainerRunnable(customRunnables) {
+			return nil, fmt.Errorf("docker option extensions set but no container image set")
+		}
+		for i, r := range customRunnables {
+			if r.Type == RunnableTypeContainer && r.Options == "" {
+				jobRequest.Job.TaskGroups[0].TaskSpec.Runnables[i].
+					GetContainer().Options = dockerOptionsExtension
+			}
+		}
+	} else if exists {
 		// override docker extensions
 		if _, ok := jobRequest.Job.TaskGroups[0].TaskSpec.
 			Runnables[execPosition].Executable.(*batchpb.Runnable_Container_); ok {
@@ -330,7 +370,9 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 		}
 
 		var accelerators []*batchpb.AllocationPolicy_Accelerator
-		installGPUDriver := false
+		// machine types with built-in GPUs (like a2-highgpu-1g)
+		m, _ := GetMachineType(jt.CandidateMachines[0])
+		installGPUDriver := m.GPUs > 0
 		if t, count, exists := GetAcceleratorsExtension(jt); exists {
 			if strings.HasPrefix(t, "nvidia") {
 				installGPUDriver = true
@@ -343,6 +385,13 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 			}
 		}
 
+		reservation, _ := GetReservationExtension(jt)
+
+		var bootDisk *batchpb.AllocationPolicy_Disk
+		if hasBootDisk {
+			bootDisk = CreateBootDisk(bootDiskImage, bootDiskType, bootDiskSizeGB)
+		}
+
 		jobRequest.Job.AllocationPolicy.Instances = []*batchpb.AllocationPolicy_InstancePolicyOrTemplate{
 			{
 				PolicyTemplate: &batchpb.AllocationPolicy_InstancePolicyOrTemplate_Policy{
@@ -351,6 +400,8 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 						MinCpuPlatform:    jt.MachineArch,
 						ProvisioningModel: provisioningModel,
 						Accelerators:      accelerators,
+						BootDisk:          bootDisk,
+						Reservation:       reservation,
 					},
 				},
 				InstallGpuDrivers: installGPUDriver,
@@ -364,12 +415,12 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 	for destination, source := range jt.StageInFiles {
 		if strings.HasPrefix(source, "gs://") {
 			jobRequest = *MountBucket(&jobRequest, execPosition, destination, source)
-		} else if strings.HasPrefix(source, "locahost:") {
+		} else if hostPath, isHostPath := localhostPath(source); isHostPath {
 			// only valid in container mode; mounts from host into container
 			if container, isContainer := jobRequest.Job.TaskGroups[0].TaskSpec.
 				Runnables[execPosition].Executable.(*batchpb.Runnable_Container_); isContainer {
 				container.Container.Volumes = append(container.Container.Volumes,
-					fmt.Sprintf("%s:%s", source, destination))
+					fmt.Sprintf("%s:%s", hostPath, destination))
 			} else {
 				return nil, fmt.Errorf("localhost: only valid when container is used")
 			}
@@ -431,6 +482,7 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 
 	// stage out files (same as stage in files, but in case of bucket
 	// we need to try to create the bucket first if it does not exist)
+	var stageOutPaths []string
 	for destination, source := range jt.StageOutFiles {
 		if strings.HasPrefix(source, "gs://") {
 			for _, bucket := range jt.StageInFiles {
@@ -440,6 +492,28 @@ func ConvertJobTemplateToJobRequest(session, project, location string, jt drmaa2
 				}
 			}
 			jobRequest = *MountBucket(&jobRequest, execPosition, destination, source)
+			stageOutPaths = append(stageOutPaths, destination)
+		}
+	}
+	if len(stageOutPaths) > 0 {
+		sort.Strings(stageOutPaths)
+		paths, err := json.Marshal(stageOutPaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode stage out files: %v", err)
+		}
+		jobRequest.Job.TaskGroups[0].TaskSpec.Environment.Variables[EnvStageOutFiles] = string(paths)
+	}
+
+	// all containers of custom runnables get the stage in/out mounts
+	if hasCustomRunnables {
+		runnables := jobRequest.Job.TaskGroups[0].TaskSpec.Runnables
+		positions := containerPositions(runnables)
+		if len(positions) > 1 {
+			stageVolumes := runnables[positions[0]].GetContainer().Volumes[stageInVolumesStart:]
+			for _, position := range positions[1:] {
+				container := runnables[position].GetContainer()
+				container.Volumes = append(container.Volumes, stageVolumes...)
+			}
 		}
 	}
 
@@ -457,6 +531,87 @@ func hasNFSVolume(volumes []*batchpb.Volume, server, path string) bool {
 	return false
 }
 
+// CreateContainer returns a container runnable for the given image
+// with the registry credentials, container options, security profile,
+// and GPU devices defined in the job template.
+func CreateContainer(jt drmaa2interface.JobTemplate, image, entrypoint string, commands []string) (*batchpb.Runnable_Container, error) {
+	// in case of a GPU job we need to add the --gpus all option
+	additionalOption := ""
+	if t, count, exists := GetAcceleratorsExtension(jt); exists &&
+		count > 0 && strings.HasPrefix(t, "nvidia") {
+		additionalOption = " --gpus all --device /dev/nvidiactl --device /dev/nvidia-uvm --device /dev/nvidia-uvm-tools"
+		for i := 0; i < int(count); i++ {
+			additionalOption += fmt.Sprintf(" --device /dev/nvidia%d", i)
+		}
+	}
+
+	// private registries: password is a Secret Manager reference
+	username, password, _ := GetContainerRegistryCredentials(jt)
+
+	imageStreaming, blockExternalNetwork, _ := GetContainerOptionsExtension(jt)
+
+	// options and host mounts are defined by the security profile
+	profileName, _ := GetContainerSecurityProfileExtension(jt)
+	profile, err := GetContainerSecurityProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batchpb.Runnable_Container{
+		ImageUri:   image,
+		Username:   username,
+		Password:   password,
+		Entrypoint: entrypoint,
+		Commands:   commands,
+		Volumes:    profile.Volumes,
+		Options: strings.TrimSpace(
+			profile.ContainerOptions(blockExternalNetwork) + additionalOption),
+		EnableImageStreaming: imageStreaming,
+		BlockExternalNetwork: blockExternalNetwork,
+	}, nil
+}
+
+// CreateLifecyclePolicies returns the lifecycle policies which retry
+// tasks failing with one of the retryExitCodes and which fail tasks
+// without retry when failing with one of the failExitCodes.
+func CreateLifecyclePolicies(retryExitCodes, failExitCodes []int32) []*batchpb.LifecyclePolicy {
+	var policies []*batchpb.LifecyclePolicy
+	if len(retryExitCodes) > 0 {
+		policies = append(policies, &batchpb.LifecyclePolicy{
+			Action: batchpb.LifecyclePolicy_RETRY_TASK,
+			ActionCondition: &batchpb.LifecyclePolicy_ActionCondition{
+				ExitCodes: retryExitCodes,
+			},
+		})
+	}
+	if len(failExitCodes) > 0 {
+		policies = append(policies, &batchpb.LifecyclePolicy{
+			Action: batchpb.LifecyclePolicy_FAIL_TASK,
+			ActionCondition: &batchpb.LifecyclePolicy_ActionCondition{
+				ExitCodes: failExitCodes,
+			},
+		})
+	}
+	return policies
+}
+
+// CreateBootDisk returns the boot disk definition of the instance policy.
+// Empty values are not set so that Google Batch uses its defaults.
+func CreateBootDisk(image, diskType string, sizeGB int64) *batchpb.AllocationPolicy_Disk {
+	disk := &batchpb.AllocationPolicy_Disk{
+		Type: diskType,
+	}
+	if sizeGB > 0 {
+		disk.SizeGb = sizeGB
+	}
+	if image != "" {
+		disk.DataSource = &batchpb.AllocationPolicy_Disk_Image{
+			Image: image,
+		}
+	}
+	return disk
+}
+
 func CreateRunnables(barriers bool, prolog string) []*batchpb.Runnable {
 	var runnable []*batchpb.Runnable
 	if barriers {
@@ -503,7 +658,26 @@ func CreateRunnables(barriers bool, prolog string) []*batchpb.Runnable {
 	return runnable
 }
 
+// ValidateJobTemplate checks the job template and sets defaults for
+// MinSlots and MaxSlots. If strict validation is enabled for the job
+// template, all problems are returned as *ValidationError.
 func ValidateJobTemplate(jt drmaa2interface.JobTemplate) (drmaa2interface.JobTemplate, error) {
+	jt, err := validateJobTemplate(jt)
+	if strict, _ := GetStrictValidationExtension(jt); !strict {
+		return jt, err
+	}
+	errs := []error{}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, strictValidationErrors(jt)...)
+	if len(errs) > 0 {
+		return jt, &ValidationError{Errors: errs}
+	}
+	return jt, nil
+}
+
+func validateJobTemplate(jt drmaa2interface.JobTemplate) (drmaa2interface.JobTemplate, error) {
 	if jt.MaxSlots == 0 {
 		jt.MaxSlots = 1
 	}
@@ -513,12 +687,118 @@ func ValidateJobTemplate(jt drmaa2interface.JobTemplate) (drmaa2interface.JobTem
 	if jt.MinSlots > jt.MaxSlots {
 		return jt, fmt.Errorf("MinSlots > MaxSlots")
 	}
-	if jt.JobCategory == "" {
+	runnables, hasCustomRunnables, err := getRunnablesExtension(jt)
+	if err != nil {
+		return jt, err
+	}
+	if hasCustomRunnables {
+		if err := ValidateRunnables(runnables, jt.MinSlots == jt.MaxSlots); err != nil {
+			return jt, err
+		}
+		_, hasProlog := GetMachinePrologExtension(jt)
+		_, hasEpilog := GetMachineEpilogExtension(jt)
+		if hasProlog || hasEpilog {
+			return jt, fmt.Errorf("prolog and epilog extensions cannot be combined with the runnables extension")
+		}
+	} else if jt.JobCategory == "" {
 		return jt, fmt.Errorf("JobCategory is empty - should be the container image")
 	}
 	if len(jt.CandidateMachines) == 0 {
 		return jt, fmt.Errorf("CandidateMachines must contain exactly the machine or image type")
 	}
+	if err := validateLabels(jt); err != nil {
+		return jt, err
+	}
+	cpuMilli, memoryMiB, tasksPerNode := taskResources(jt)
+	if err := validateMachineCapacity(jt.CandidateMachines[0], cpuMilli, memoryMiB, tasksPerNode); err != nil {
+		return jt, err
+	}
+	// boot disk extensions: image, disk type, and size in GB (see
+	// SetBootDiskExtension())
+	if _, bootDiskType, _, hasBootDisk := GetBootDiskExtension(jt); hasBootDisk {
+		if strings.HasPrefix(jt.CandidateMachines[0], "template:") {
+			return jt, fmt.Errorf("boot disk extensions cannot be combined with an instance template")
+		}
+		if size, exists := jt.ExtensionList[ExtensionBootDiskSizeGB]; exists {
+			if sizeGB, err := strconv.ParseInt(size, 10, 64); err != nil || sizeGB <= 0 {
+				return jt, fmt.Errorf("invalid boot disk size: %s", size)
+			}
+		}
+		if bootDiskType == "local-ssd" {
+			return jt, fmt.Errorf("local-ssd cannot be used as boot disk type")
+		}
+	}
+	_, hasReservation := GetReservationExtension(jt)
+	collocation, _, hasPlacement := GetPlacementPolicyExtension(jt)
+	if hasReservation || hasPlacement {
+		// like MPI jobs which are using barriers
+		if jt.MinSlots != jt.MaxSlots || jt.MaxSlots < 2 {
+			return jt, fmt.Errorf("reservation and placement policy extensions require a parallel job (MinSlots = MaxSlots > 1)")
+		}
+	}
+	if hasReservation && strings.HasPrefix(jt.CandidateMachines[0], "template:") {
+		return jt, fmt.Errorf("reservation extension cannot be combined with an instance template")
+	}
+	if hasPlacement {
+		if collocation != "" && collocation != "COLLOCATED" {
+			return jt, fmt.Errorf("unsupported placement collocation: %s", collocation)
+		}
+		if distance, exists := jt.ExtensionList[ExtensionPlacementMaxDistance]; exists {
+			if maxDistance, err := strconv.ParseInt(distance, 10, 64); err != nil || maxDistance <= 0 {
+				return jt, fmt.Errorf("invalid placement max distance: %s", distance)
+			}
+		}
+	}
+	if retries, exists := jt.ExtensionList[ExtensionMaxRetryCount]; exists {
+		if count, err := strconv.ParseInt(retries, 10, 32); err != nil || count < 0 || count > 10 {
+			return jt, fmt.Errorf("invalid max retry count (must be 0-10): %s", retries)
+		}
+	}
+	if _, _, exists := GetLifecyclePoliciesExtension(jt); exists {
+		retryExitCodes, err := parseExitCodes(jt.ExtensionList[ExtensionRetryExitCodes])
+		if err != nil {
+			return jt, fmt.Errorf("invalid retry exit codes: %v", err)
+		}
+		failExitCodes, err := parseExitCodes(jt.ExtensionList[ExtensionFailExitCodes])
+		if err != nil {
+			return jt, fmt.Errorf("invalid fail exit codes: %v", err)
+		}
+		for _, retry := range retryExitCodes {
+			for _, fail := range failExitCodes {
+				if retry == fail {
+					return jt, fmt.Errorf("exit code %d is used for retry and fail", retry)
+				}
+			}
+		}
+	}
+	isContainer := jt.JobCategory != JobCategoryScript &&
+		jt.JobCategory != JobCategoryScriptPath
+	if hasCustomRunnables {
+		isContainer = hasContainerRunnable(runnables)
+	}
+	if _, password, exists := GetContainerRegistryCredentials(jt); exists {
+		if !isContainer {
+			return jt, fmt.Errorf("registry credentials set but no container image set")
+		}
+		if !strings.HasPrefix(password, "projects/") ||
+			!strings.Contains(password, "/secrets/") {
+			return jt, fmt.Errorf("registry password must be a Secret Manager reference (projects/<project>/secrets/<secret>/versions/<version>)")
+		}
+	}
+	if _, blockExternalNetwork, exists := GetContainerOptionsExtension(jt); exists {
+		if !isContainer {
+			return jt, fmt.Errorf("container options set but no container image set")
+		}
+		dockerOptions, _ := GetDockerOptionsExtension(jt)
+		if blockExternalNetwork && strings.Contains(dockerOptions, "--network") {
+			return jt, fmt.Errorf("docker options must not set the network when external network is blocked")
+		}
+	}
+	if profile, exists := GetContainerSecurityProfileExtension(jt); exists {
+		if _, err := GetContainerSecurityProfile(profile); err != nil {
+			return jt, err
+		}
+	}
 	if jt.ErrorPath != "" && jt.OutputPath != "" {
 		if jt.ErrorPath != jt.OutputPath {
 			return jt, fmt.Errorf("ErrorPath and OutputPath must be the same or one unset")
@@ -549,8 +829,13 @@ func GetJobTemplateFromBase64(base64encondedJT string) (drmaa2interface.JobTempl
 }
 
 // DefaultCPUMilli returns the CPU resource limit in milli cores which
-// fits to the given machine type.
+// fits to the given machine type. Machine types which are not in the
+// catalog (see GetMachineType()) are expected to end with the amount
+// of cores.
 func DefaultCPUMilli(machine string) int64 {
+	if m, known := GetMachineType(machine); known {
+		return m.CPUs * 1000
+	}
 	/* Examples:
 	f1-micro              europe-west2-c             1     0.60
 	g1-small              europe-west2-c             1     1.70
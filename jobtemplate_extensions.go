@@ -3,6 +3,7 @@ package gcpbatchtracker
 import (
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -19,6 +20,84 @@ const (
 	ExtensionTasksPerNode    = "tasks_per_node"
 	ExtensionDockerOptions   = "docker_options"
 	ExtensionGoogleSecretEnv = "secret_env"
+	// ExtensionBootDiskImage is the image of the boot disk of the VMs
+	// (like "batch-hpc-centos" or "projects/<project>/global/images/
+	// family/<family>")
+	ExtensionBootDiskImage = "boot_disk_image"
+	// ExtensionBootDiskType is the disk type of the boot disk of the
+	// VMs (like "pd-ssd" or "pd-balanced"; "local-ssd" is not allowed)
+	ExtensionBootDiskType = "boot_disk_type"
+	// ExtensionBootDiskSizeGB is the size of the boot disk of the VMs
+	// in GB (a positive integer like "100"); it supersedes the
+	// "bootdiskmib" resource limit
+	ExtensionBootDiskSizeGB = "boot_disk_size_gb"
+	// ExtensionReservation is the name of a Compute Engine reservation
+	// the VMs are allocated from
+	ExtensionReservation = "reservation"
+	// ExtensionPlacementCollocation is the collocation of the VMs of
+	// a job (only "COLLOCATED" is supported by Google Batch)
+	ExtensionPlacementCollocation = "placement_collocation"
+	// ExtensionPlacementMaxDistance is the maximum distance between
+	// the VMs of a job
+	ExtensionPlacementMaxDistance = "placement_max_distance"
+	// ExtensionMaxRetryCount is the amount of retries of a failed
+	// task (0-10)
+	ExtensionMaxRetryCount = "max_retry_count"
+	// ExtensionRetryExitCodes is a comma separated list of exit codes
+	// for which a failed task is retried
+	ExtensionRetryExitCodes = "retry_exit_codes"
+	// ExtensionFailExitCodes is a comma separated list of exit codes
+	// for which a failed task is not retried
+	ExtensionFailExitCodes = "fail_exit_codes"
+	// ExtensionContainerRegistryCredentials contains the username and
+	// the Secret Manager reference of the password for pulling the
+	// container image from a private registry
+	ExtensionContainerRegistryCredentials = "container_registry_credentials"
+	// ExtensionContainerImageStreaming enables image streaming
+	// for the container image ("true"/"false")
+	ExtensionContainerImageStreaming = "image_streaming"
+	// ExtensionContainerBlockExternalNetwork blocks the external network
+	// access of the container ("true"/"false")
+	ExtensionContainerBlockExternalNetwork = "block_external_network"
+	// ExtensionContainerSecurityProfile is the name of the container
+	// security profile ("mpi", "default", "restricted")
+	ExtensionContainerSecurityProfile = "container_security_profile"
+	// ExtensionRunnables is a base64 encoded JSON list of runnables
+	// which replaces the default runnable layout of a task
+	ExtensionRunnables = "runnables"
+	// ExtensionStrictValidation enables the strict validation of the
+	// job template ("true"/"false")
+	ExtensionStrictValidation = "strict_validation"
+	// ExtensionLabels is a base64 encoded JSON map of user defined
+	// labels of the job and its VMs
+	ExtensionLabels = "labels"
+	// ExtensionNetwork is the VPC network of the VMs (like
+	// "projects/<project>/global/networks/<network>")
+	ExtensionNetwork = "network"
+	// ExtensionSubnetwork is the subnetwork of the VMs (like
+	// "projects/<project>/regions/<region>/subnetworks/<subnetwork>")
+	ExtensionSubnetwork = "subnetwork"
+	// ExtensionServiceAccount is the email of the service account
+	// of the VMs
+	ExtensionServiceAccount = "service_account"
+	// ExtensionAllowedLocations is a comma separated list of zones
+	// or regions in which the VMs are created (like "us-central1-a")
+	ExtensionAllowedLocations = "allowed_locations"
+	// ExtensionLocation is the location (region) of the job which is
+	// used by the MultiLocationTracker (like "europe-west4")
+	ExtensionLocation = "location"
+	// ExtensionJobOwner is the owner of the job which is stored in the
+	// "drmaa2owner" label (see SetJobOwner())
+	ExtensionJobOwner = "job_owner"
+)
+
+// zones like "us-central1-a" (regions like "us-central1" have no suffix)
+var zonePattern = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+const (
+	// ExitCodeSpotPreemption is the exit code of a task which
+	// was running on a spot VM which got preempted.
+	ExitCodeSpotPreemption = 50001
 )
 
 func GetMachinePrologExtension(jt drmaa2interface.JobTemplate) (string, bool) {
@@ -151,13 +230,10 @@ func SetSecretEnvironmentVariables(jt drmaa2interface.JobTemplate, secretEnv map
 	if jt.ExtensionList == nil {
 		jt.ExtensionList = make(map[string]string)
 	}
-	// convert to JSON
-	encoded, err := json.Marshal(secretEnv)
+	b64Secrets, err := encodeExtensionMap(secretEnv)
 	if err != nil {
 		return jt, fmt.Errorf("could not encode secret environment variables: %v", err)
 	}
-	// base64 envoding for encoded
-	b64Secrets := base64.StdEncoding.EncodeToString(encoded)
 	jt.ExtensionList[ExtensionGoogleSecretEnv] = b64Secrets
 	return jt, nil
 }
@@ -170,16 +246,365 @@ func GetSecretEnvironmentVariables(jt drmaa2interface.JobTemplate) (map[string]s
 	if !hasSecretEnv {
 		return nil, false
 	}
-	// decode base64
-	decoded, err := base64.StdEncoding.DecodeString(secretEnv)
+	return decodeExtensionMap(secretEnv)
+}
+
+// encodeExtensionMap converts a map into a base64 encoded JSON
+// string so that it can be stored as a job template extension.
+func encodeExtensionMap(m map[string]string) (string, error) {
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+func decodeExtensionMap(extension string) (map[string]string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(extension)
+	if err != nil {
+		return nil, false
+	}
+	var m map[string]string
+	err = json.Unmarshal(decoded, &m)
 	if err != nil {
 		return nil, false
 	}
-	// convert from JSON
-	var secretEnvMap map[string]string
-	err = json.Unmarshal(decoded, &secretEnvMap)
+	return m, true
+}
+
+// SetContainerRegistryCredentials sets the credentials for pulling
+// the container image (JobCategory) from a private registry. The
+// password is not stored in the job template. Instead it is the path
+// to the secret in Google Secret Manager which contains the password
+// (like "projects/dev/secrets/registry_password/versions/1").
+func SetContainerRegistryCredentials(jt drmaa2interface.JobTemplate, username, passwordSecret string) (drmaa2interface.JobTemplate, error) {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	b64Credentials, err := encodeExtensionMap(map[string]string{
+		"username": username,
+		"password": passwordSecret,
+	})
 	if err != nil {
+		return jt, fmt.Errorf("could not encode registry credentials: %v", err)
+	}
+	jt.ExtensionList[ExtensionContainerRegistryCredentials] = b64Credentials
+	return jt, nil
+}
+
+// GetContainerRegistryCredentials returns the username and the Secret
+// Manager path of the password for the container registry.
+func GetContainerRegistryCredentials(jt drmaa2interface.JobTemplate) (string, string, bool) {
+	if jt.ExtensionList == nil {
+		return "", "", false
+	}
+	extension, hasExtension := jt.ExtensionList[ExtensionContainerRegistryCredentials]
+	if !hasExtension {
+		return "", "", false
+	}
+	credentials, ok := decodeExtensionMap(extension)
+	if !ok {
+		return "", "", false
+	}
+	return credentials["username"], credentials["password"], true
+}
+
+// SetContainerOptionsExtension enables image streaming and/or blocks
+// the external network access of the container. Blocking the external
+// network removes the default "--network=host" docker option.
+func SetContainerOptionsExtension(jt drmaa2interface.JobTemplate, imageStreaming, blockExternalNetwork bool) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionContainerImageStreaming] = strconv.FormatBool(imageStreaming)
+	jt.ExtensionList[ExtensionContainerBlockExternalNetwork] = strconv.FormatBool(blockExternalNetwork)
+	return jt
+}
+
+// GetContainerOptionsExtension returns if image streaming is enabled
+// and if the external network is blocked for the container.
+func GetContainerOptionsExtension(jt drmaa2interface.JobTemplate) (bool, bool, bool) {
+	if jt.ExtensionList == nil {
+		return false, false, false
+	}
+	streaming, hasStreaming := jt.ExtensionList[ExtensionContainerImageStreaming]
+	block, hasBlock := jt.ExtensionList[ExtensionContainerBlockExternalNetwork]
+	if !hasStreaming && !hasBlock {
+		return false, false, false
+	}
+	imageStreaming, _ := strconv.ParseBool(streaming)
+	blockExternalNetwork, _ := strconv.ParseBool(block)
+	return imageStreaming, blockExternalNetwork, true
+}
+
+// SetBootDiskExtension sets the boot disk of the machines the job
+// runs on. The image can be a Batch image like "batch-hpc-centos" or
+// a full image path like "projects/my-project/global/images/family/hpc".
+// The disk type is a Compute Engine disk type like "pd-ssd". The size
+// is in GB. Empty strings and a size <= 0 are not set and hence let
+// Google Batch choose the default.
+func SetBootDiskExtension(jt drmaa2interface.JobTemplate, image, diskType string, sizeGB int64) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	if image != "" {
+		jt.ExtensionList[ExtensionBootDiskImage] = image
+	}
+	if diskType != "" {
+		jt.ExtensionList[ExtensionBootDiskType] = diskType
+	}
+	if sizeGB > 0 {
+		jt.ExtensionList[ExtensionBootDiskSizeGB] = strconv.FormatInt(sizeGB, 10)
+	}
+	return jt
+}
+
+// GetBootDiskExtension returns the boot disk image, disk type, and
+// size in GB which are set as job template extensions. The last return
+// value is false if none of the boot disk extensions is set.
+func GetBootDiskExtension(jt drmaa2interface.JobTemplate) (string, string, int64, bool) {
+	if jt.ExtensionList == nil {
+		return "", "", 0, false
+	}
+	image, hasImage := jt.ExtensionList[ExtensionBootDiskImage]
+	diskType, hasType := jt.ExtensionList[ExtensionBootDiskType]
+	size, hasSize := jt.ExtensionList[ExtensionBootDiskSizeGB]
+	if !hasImage && !hasType && !hasSize {
+		return "", "", 0, false
+	}
+	sizeGB, _ := strconv.ParseInt(size, 10, 64)
+	return image, diskType, sizeGB, true
+}
+
+// SetReservationExtension sets the Compute Engine reservation from which
+// the VMs are allocated. It can be the reservation name or the full
+// path like "projects/p/zones/z/reservations/r". Reservations can
+// only be used for parallel jobs (MinSlots == MaxSlots > 1).
+func SetReservationExtension(jt drmaa2interface.JobTemplate, reservation string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionReservation] = reservation
+	return jt
+}
+
+func GetReservationExtension(jt drmaa2interface.JobTemplate) (string, bool) {
+	if jt.ExtensionList == nil {
+		return "", false
+	}
+	extension, hasExtension := jt.ExtensionList[ExtensionReservation]
+	return extension, hasExtension
+}
+
+// SetPlacementPolicyExtension sets the compute placement policy for
+// tightly coupled jobs. Collocation can be "COLLOCATED" (or "" when
+// not set) and maxDistance is the maximum distance between the VMs
+// (0 when not set). Placement policies can only be used for parallel
+// jobs (MinSlots == MaxSlots > 1).
+func SetPlacementPolicyExtension(jt drmaa2interface.JobTemplate, collocation string, maxDistance int64) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	if collocation != "" {
+		jt.ExtensionList[ExtensionPlacementCollocation] = collocation
+	}
+	if maxDistance > 0 {
+		jt.ExtensionList[ExtensionPlacementMaxDistance] = strconv.FormatInt(maxDistance, 10)
+	}
+	return jt
+}
+
+// GetPlacementPolicyExtension returns the collocation and the max.
+// distance of the placement policy. The last return value is false
+// if no placement policy extension is set.
+func GetPlacementPolicyExtension(jt drmaa2interface.JobTemplate) (string, int64, bool) {
+	if jt.ExtensionList == nil {
+		return "", 0, false
+	}
+	collocation, hasCollocation := jt.ExtensionList[ExtensionPlacementCollocation]
+	distance, hasDistance := jt.ExtensionList[ExtensionPlacementMaxDistance]
+	if !hasCollocation && !hasDistance {
+		return "", 0, false
+	}
+	maxDistance, _ := strconv.ParseInt(distance, 10, 64)
+	return strings.ToUpper(collocation), maxDistance, true
+}
+
+// SetMaxRetryCountExtension sets the amount of retries (0-10) of a
+// task before it is considered as failed. Useful for spot jobs.
+func SetMaxRetryCountExtension(jt drmaa2interface.JobTemplate, count int32) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionMaxRetryCount] = strconv.FormatInt(int64(count), 10)
+	return jt
+}
+
+func GetMaxRetryCountExtension(jt drmaa2interface.JobTemplate) (int32, bool) {
+	if jt.ExtensionList == nil {
+		return 0, false
+	}
+	extension, hasExtension := jt.ExtensionList[ExtensionMaxRetryCount]
+	if hasExtension {
+		count, _ := strconv.ParseInt(extension, 10, 32)
+		return int32(count), true
+	}
+	return 0, false
+}
+
+// SetLifecyclePoliciesExtension sets the exit codes for which a failed
+// task is retried (like ExitCodeSpotPreemption) and the exit codes for
+// which a failed task fails immediately without any retry. Retries
+// are limited by the max retry count extension.
+func SetLifecyclePoliciesExtension(jt drmaa2interface.JobTemplate, retryExitCodes, failExitCodes []int32) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	if len(retryExitCodes) > 0 {
+		jt.ExtensionList[ExtensionRetryExitCodes] = formatExitCodes(retryExitCodes)
+	}
+	if len(failExitCodes) > 0 {
+		jt.ExtensionList[ExtensionFailExitCodes] = formatExitCodes(failExitCodes)
+	}
+	return jt
+}
+
+// GetLifecyclePoliciesExtension returns the exit codes for which a task
+// is retried and the exit codes for which a task fails immediately.
+// Exit codes which cannot be parsed are skipped.
+func GetLifecyclePoliciesExtension(jt drmaa2interface.JobTemplate) ([]int32, []int32, bool) {
+	if jt.ExtensionList == nil {
+		return nil, nil, false
+	}
+	retry, hasRetry := jt.ExtensionList[ExtensionRetryExitCodes]
+	fail, hasFail := jt.ExtensionList[ExtensionFailExitCodes]
+	if !hasRetry && !hasFail {
+		return nil, nil, false
+	}
+	retryExitCodes, _ := parseExitCodes(retry)
+	failExitCodes, _ := parseExitCodes(fail)
+	return retryExitCodes, failExitCodes, true
+}
+
+func formatExitCodes(exitCodes []int32) string {
+	codes := make([]string, 0, len(exitCodes))
+	for _, code := range exitCodes {
+		codes = append(codes, strconv.FormatInt(int64(code), 10))
+	}
+	return strings.Join(codes, ",")
+}
+
+func parseExitCodes(exitCodes string) ([]int32, error) {
+	var codes []int32
+	var lastErr error
+	for _, code := range strings.Split(exitCodes, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		c, err := strconv.ParseInt(code, 10, 32)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid exit code: %s", code)
+			continue
+		}
+		codes = append(codes, int32(c))
+	}
+	return codes, lastErr
+}
+
+// SetNetworkExtension sets the VPC network and subnetwork of the VMs.
+// Empty values are not set.
+func SetNetworkExtension(jt drmaa2interface.JobTemplate, network, subnetwork string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	if network != "" {
+		jt.ExtensionList[ExtensionNetwork] = network
+	}
+	if subnetwork != "" {
+		jt.ExtensionList[ExtensionSubnetwork] = subnetwork
+	}
+	return jt
+}
+
+func GetNetworkExtension(jt drmaa2interface.JobTemplate) (string, string, bool) {
+	if jt.ExtensionList == nil {
+		return "", "", false
+	}
+	network, hasNetwork := jt.ExtensionList[ExtensionNetwork]
+	subnetwork, hasSubnetwork := jt.ExtensionList[ExtensionSubnetwork]
+	return network, subnetwork, hasNetwork || hasSubnetwork
+}
+
+func SetServiceAccountExtension(jt drmaa2interface.JobTemplate, email string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionServiceAccount] = email
+	return jt
+}
+
+func GetServiceAccountExtension(jt drmaa2interface.JobTemplate) (string, bool) {
+	if jt.ExtensionList == nil {
+		return "", false
+	}
+	email, exists := jt.ExtensionList[ExtensionServiceAccount]
+	return email, exists
+}
+
+// SetAllowedLocationsExtension sets the zones or regions in which the
+// VMs of the job are created. They must be in the location of the job.
+func SetAllowedLocationsExtension(jt drmaa2interface.JobTemplate, locations []string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionAllowedLocations] = strings.Join(locations, ",")
+	return jt
+}
+
+func GetAllowedLocationsExtension(jt drmaa2interface.JobTemplate) ([]string, bool) {
+	if jt.ExtensionList == nil {
+		return nil, false
+	}
+	extension, exists := jt.ExtensionList[ExtensionAllowedLocations]
+	if !exists {
 		return nil, false
 	}
-	return secretEnvMap, true
+	var locations []string
+	for _, location := range strings.Split(extension, ",") {
+		if location = strings.TrimSpace(location); location != "" {
+			locations = append(locations, location)
+		}
+	}
+	return locations, true
+}
+
+// allowedLocation returns the location in the format which is used by
+// the location policy ("zones/<zone>" or "regions/<region>").
+func allowedLocation(location string) string {
+	if strings.HasPrefix(location, "zones/") || strings.HasPrefix(location, "regions/") {
+		return location
+	}
+	if zonePattern.MatchString(location) {
+		return "zones/" + location
+	}
+	return "regions/" + location
+}
+
+// SetLocationExtension sets the location (region) in which the
+// MultiLocationTracker submits the job.
+func SetLocationExtension(jt drmaa2interface.JobTemplate, location string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionLocation] = location
+	return jt
+}
+
+func GetLocationExtension(jt drmaa2interface.JobTemplate) (string, bool) {
+	if jt.ExtensionList == nil {
+		return "", false
+	}
+	location, exists := jt.ExtensionList[ExtensionLocation]
+	return location, exists
 }
@@ -72,6 +72,57 @@ var _ = Describe("JobtemplateExtensions", func() {
 			Expect(docker).To(Equal("--rm"))
 		})
 
+		It("should set the boot disk", func() {
+			jt := drmaa2interface.JobTemplate{}
+			_, _, _, exists := GetBootDiskExtension(jt)
+			Expect(exists).To(BeFalse())
+			jt = SetBootDiskExtension(jt, "batch-hpc-centos", "pd-ssd", 100)
+			Expect(jt.ExtensionList).To(HaveKey(ExtensionBootDiskImage))
+			Expect(jt.ExtensionList[ExtensionBootDiskSizeGB]).To(Equal("100"))
+			image, diskType, size, exists := GetBootDiskExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(image).To(Equal("batch-hpc-centos"))
+			Expect(diskType).To(Equal("pd-ssd"))
+			Expect(size).To(Equal(int64(100)))
+		})
+
+		It("should set a reservation and placement policy", func() {
+			jt := drmaa2interface.JobTemplate{}
+			_, exists := GetReservationExtension(jt)
+			Expect(exists).To(BeFalse())
+			jt = SetReservationExtension(jt, "my-reservation")
+			reservation, exists := GetReservationExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(reservation).To(Equal("my-reservation"))
+
+			_, _, exists = GetPlacementPolicyExtension(jt)
+			Expect(exists).To(BeFalse())
+			jt = SetPlacementPolicyExtension(jt, "collocated", 2)
+			collocation, maxDistance, exists := GetPlacementPolicyExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(collocation).To(Equal("COLLOCATED"))
+			Expect(maxDistance).To(Equal(int64(2)))
+		})
+
+		It("should set the max retry count and lifecycle policies", func() {
+			jt := drmaa2interface.JobTemplate{}
+			_, exists := GetMaxRetryCountExtension(jt)
+			Expect(exists).To(BeFalse())
+			jt = SetMaxRetryCountExtension(jt, 3)
+			retries, exists := GetMaxRetryCountExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(retries).To(Equal(int32(3)))
+
+			jt = SetLifecyclePoliciesExtension(jt,
+				[]int32{ExitCodeSpotPreemption, 1}, []int32{42})
+			Expect(jt.ExtensionList[ExtensionRetryExitCodes]).To(Equal("50001,1"))
+			Expect(jt.ExtensionList[ExtensionFailExitCodes]).To(Equal("42"))
+			retryExitCodes, failExitCodes, exists := GetLifecyclePoliciesExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(retryExitCodes).To(Equal([]int32{50001, 1}))
+			Expect(failExitCodes).To(Equal([]int32{42}))
+		})
+
 		It("should set secret environment variables", func() {
 			jt := drmaa2interface.JobTemplate{}
 			jt, err := SetSecretEnvironmentVariables(jt, map[string]string{
@@ -89,6 +140,25 @@ var _ = Describe("JobtemplateExtensions", func() {
 			Expect(value["MY_OTHER_PASSWORD_FROM_GOOGLE_SECRETS"]).To(Equal("projects/ev/secrets/other_secret/versions/1"))
 		})
 
+		It("should set container registry credentials and options", func() {
+			jt := drmaa2interface.JobTemplate{}
+			_, _, exists := GetContainerRegistryCredentials(jt)
+			Expect(exists).To(BeFalse())
+			jt, err := SetContainerRegistryCredentials(jt, "_json_key",
+				"projects/dev/secrets/registry_password/versions/1")
+			Expect(err).To(BeNil())
+			username, password, exists := GetContainerRegistryCredentials(jt)
+			Expect(exists).To(BeTrue())
+			Expect(username).To(Equal("_json_key"))
+			Expect(password).To(Equal("projects/dev/secrets/registry_password/versions/1"))
+
+			jt = SetContainerOptionsExtension(jt, true, false)
+			imageStreaming, blockExternalNetwork, exists := GetContainerOptionsExtension(jt)
+			Expect(exists).To(BeTrue())
+			Expect(imageStreaming).To(BeTrue())
+			Expect(blockExternalNetwork).To(BeFalse())
+		})
+
 	})
 
 })
@@ -94,6 +94,24 @@ var _ = Describe("Jobtemplate", func() {
 			Expect(err).To(BeNil())
 			// it should set per default to the expected amount of milli cores
 			Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.CpuMilli).To(Equal(int64(160000)))
+			// the memory is not set per default
+			Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.MemoryMib).To(Equal(int64(0)))
+		})
+
+		It("should reject resource limits which don't fit on the machine type", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				CandidateMachines: []string{"e2-standard-4"},
+				MinPhysMemory:     32768, // e2-standard-4 has 16 GB
+			}
+			_, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+
+			jt.MinPhysMemory = 0
+			jt.ResourceLimits = map[string]string{"cpumilli": "2500"}
+			jt = SetTasksPerNodeExtension(jt, 2)
+			_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
 		})
 
 	})
@@ -118,6 +136,167 @@ var _ = Describe("Jobtemplate", func() {
 			Expect(options).To(Equal("--network=host"))
 		})
 
+		It("should set the boot disk and supersede the bootdiskmib resource limit", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MaxSlots:          1, // one machine
+				CandidateMachines: []string{"c2-standard-60"},
+				ResourceLimits: map[string]string{
+					"bootdiskmib": "10240",
+				},
+			}
+			jt = SetBootDiskExtension(jt, "batch-hpc-centos", "pd-ssd", 100)
+
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			bootDisk := req.Job.AllocationPolicy.Instances[0].GetPolicy().BootDisk
+			Expect(bootDisk).NotTo(BeNil())
+			Expect(bootDisk.GetImage()).To(Equal("batch-hpc-centos"))
+			Expect(bootDisk.Type).To(Equal("pd-ssd"))
+			Expect(bootDisk.SizeGb).To(Equal(int64(100)))
+			Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.BootDiskMib).To(Equal(int64(100 * 1024)))
+		})
+
+		It("should reject boot disk extensions for instance templates", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MaxSlots:          1, // one machine
+				CandidateMachines: []string{"template:mytemplate"},
+			}
+			jt = SetBootDiskExtension(jt, "", "pd-ssd", 0)
+			_, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+
+			jt.CandidateMachines = []string{"c2-standard-60"}
+			jt.ExtensionList[ExtensionBootDiskSizeGB] = "big"
+			_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should set reservation and placement policy for parallel jobs", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MinSlots:          4,
+				MaxSlots:          4,
+				CandidateMachines: []string{"c2-standard-60"},
+			}
+			jt = SetReservationExtension(jt, "mpi-reservation")
+			jt = SetPlacementPolicyExtension(jt, "COLLOCATED", 1)
+
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			Expect(req.Job.AllocationPolicy.Instances[0].GetPolicy().Reservation).To(Equal("mpi-reservation"))
+			Expect(req.Job.AllocationPolicy.Placement).NotTo(BeNil())
+			Expect(req.Job.AllocationPolicy.Placement.Collocation).To(Equal("COLLOCATED"))
+			Expect(req.Job.AllocationPolicy.Placement.MaxDistance).To(Equal(int64(1)))
+		})
+
+		It("should reject reservation and placement policy for non-parallel jobs", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MinSlots:          1,
+				MaxSlots:          10,
+				CandidateMachines: []string{"c2-standard-60"},
+			}
+			_, err := ValidateJobTemplate(SetPlacementPolicyExtension(jt, "COLLOCATED", 0))
+			Expect(err).To(HaveOccurred())
+
+			jt.ExtensionList = nil
+			_, err = ValidateJobTemplate(SetReservationExtension(jt, "mpi-reservation"))
+			Expect(err).To(HaveOccurred())
+
+			jt.ExtensionList = nil
+			jt.MinSlots = 1
+			jt.MaxSlots = 1
+			_, err = ValidateJobTemplate(SetReservationExtension(jt, "mpi-reservation"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should set the retry count and lifecycle policies", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MaxSlots:          1,
+				CandidateMachines: []string{"e2-standard-4"},
+			}
+			jt = SetSpotExtension(jt, true)
+			jt = SetMaxRetryCountExtension(jt, 5)
+			jt = SetLifecyclePoliciesExtension(jt, []int32{ExitCodeSpotPreemption}, []int32{1, 2})
+
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			taskSpec := req.Job.TaskGroups[0].TaskSpec
+			Expect(taskSpec.MaxRetryCount).To(Equal(int32(5)))
+			Expect(taskSpec.LifecyclePolicies).To(HaveLen(2))
+			Expect(taskSpec.LifecyclePolicies[0].Action).To(Equal(batchpb.LifecyclePolicy_RETRY_TASK))
+			Expect(taskSpec.LifecyclePolicies[0].ActionCondition.ExitCodes).To(Equal([]int32{50001}))
+			Expect(taskSpec.LifecyclePolicies[1].Action).To(Equal(batchpb.LifecyclePolicy_FAIL_TASK))
+			Expect(taskSpec.LifecyclePolicies[1].ActionCondition.ExitCodes).To(Equal([]int32{1, 2}))
+
+			jt = SetMaxRetryCountExtension(jt, 11)
+			_, err = ValidateJobTemplate(jt)
+			Expect(err).To(HaveOccurred())
+
+			jt = SetMaxRetryCountExtension(jt, 1)
+			jt = SetLifecyclePoliciesExtension(jt, []int32{1}, nil)
+			_, err = ValidateJobTemplate(jt)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should set private registry credentials and container options", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "europe-docker.pkg.dev/project/repo/image:1.0",
+				MaxSlots:          1,
+				CandidateMachines: []string{"e2-standard-4"},
+			}
+			jt, err := SetContainerRegistryCredentials(jt, "user",
+				"projects/dev/secrets/registry_password/versions/1")
+			Expect(err).To(BeNil())
+			jt = SetContainerOptionsExtension(jt, true, true)
+
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			container := req.Job.TaskGroups[0].TaskSpec.Runnables[3].Executable.(*batchpb.Runnable_Container_).Container
+			Expect(container.Username).To(Equal("user"))
+			Expect(container.Password).To(Equal("projects/dev/secrets/registry_password/versions/1"))
+			Expect(container.EnableImageStreaming).To(BeTrue())
+			Expect(container.BlockExternalNetwork).To(BeTrue())
+			Expect(container.Options).NotTo(ContainSubstring("--network"))
+
+			jt, err = SetContainerRegistryCredentials(jt, "user", "plaintext")
+			Expect(err).To(BeNil())
+			_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should apply the container security profile", func() {
+			jt := drmaa2interface.JobTemplate{
+				JobCategory:       "ubuntu:18.04",
+				MaxSlots:          1,
+				CandidateMachines: []string{"n1-standard-4"},
+			}
+			jt = SetAcceleratorsExtension(jt, 1, "nvidia-tesla-t4")
+			jt = SetContainerSecurityProfileExtension(jt, ContainerSecurityProfileRestricted)
+
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			container := req.Job.TaskGroups[0].TaskSpec.Runnables[3].Executable.(*batchpb.Runnable_Container_).Container
+			Expect(container.Options).NotTo(ContainSubstring("--privileged"))
+			Expect(container.Options).To(ContainSubstring("--gpus all"))
+			Expect(container.Options).To(ContainSubstring("--device /dev/nvidia0"))
+			Expect(container.Volumes).To(BeEmpty())
+
+			jt = SetContainerSecurityProfileExtension(jt, ContainerSecurityProfileDefault)
+			req, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			container = req.Job.TaskGroups[0].TaskSpec.Runnables[3].Executable.(*batchpb.Runnable_Container_).Container
+			Expect(container.Options).To(HavePrefix("--network=host --gpus all"))
+			Expect(container.Volumes).To(HaveLen(1))
+
+			jt = SetContainerSecurityProfileExtension(jt, "unknown")
+			_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("should set secret environment variables", func() {
 
 			jt := drmaa2interface.JobTemplate{
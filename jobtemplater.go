@@ -1,10 +1,8 @@
 package gcpbatchtracker
 
 import (
-	"context"
 	"fmt"
 
-	"cloud.google.com/go/batch/apiv1/batchpb"
 	"github.com/dgruber/drmaa2interface"
 )
 
@@ -13,29 +11,25 @@ import (
 // needs to be stored somewhere. The easiest way is to store is as env
 // variable of the job so that it can be retrieved directly from the
 // backend and does not need to be stored in a local database.
+// For jobs which were not submitted through DRMAA2 the job template
+// is reconstructed from the Google Batch job spec.
 
 func (t *GCPBatchTracker) JobTemplate(jobID string) (drmaa2interface.JobTemplate, error) {
 
 	// get job template from env variables
-	job, err := t.client.GetJob(context.Background(),
-		&batchpb.GetJobRequest{
-			Name: jobID,
-		})
+	job, err := t.getJob(jobID)
 	if err != nil {
 		return drmaa2interface.JobTemplate{},
-			fmt.Errorf("could not get job %s: %v", jobID, err)
+			fmt.Errorf("could not get job %s: %w", jobID, err)
 	}
 
-	for _, group := range job.GetTaskGroups() {
-		if group.TaskSpec != nil && group.TaskSpec.Environment != nil &&
-			group.TaskSpec.Environment.Variables != nil {
-			value, exists := group.TaskSpec.Environment.Variables[EnvJobTemplate]
-			if exists {
-				return GetJobTemplateFromBase64(value)
-			}
+	for i := range job.GetTaskGroups() {
+		if value, exists := jobTemplateValue(job, i); exists {
+			return GetJobTemplateFromEnv(value)
 		}
 	}
 
-	return drmaa2interface.JobTemplate{},
-		fmt.Errorf("could not find job template in env variables")
+	// job was not submitted by DRMAA2 (like gcloud or Terraform):
+	// reconstruct the job template from the job spec
+	return BatchJobToJobTemplate(job)
 }
@@ -0,0 +1,318 @@
+package gcpbatchtracker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+// The job template of a job is stored so that it can be retrieved later
+// by JobTemplate() and GetJobTemplateExtensionFromJobInfo(). By default
+// it is stored base64 encoded in the DRMAA2_JOB_TEMPLATE environment
+// variable of the job. As this makes the job template visible to all
+// tasks and runs into the size limits of Google Batch for large job
+// templates, it can be stored compressed, in a GCS bucket, or in a local
+// directory. GCS objects are referenced by the job labels (the object
+// name is derived from the job ID) and the environment variable is not
+// set. For local files the environment variable contains the reference
+// to the file (like file:///dir/file.json).
+
+const (
+	// JobTemplateStorageEnv stores the job template base64 encoded
+	// in the environment variable (default)
+	JobTemplateStorageEnv = "env"
+	// JobTemplateStorageCompressedEnv stores the job template gzip
+	// compressed and base64 encoded in the environment variable
+	JobTemplateStorageCompressedEnv = "gzip"
+	// JobTemplateStorageGCS stores the job template as object in a
+	// GCS bucket
+	JobTemplateStorageGCS = "gcs"
+	// JobTemplateStorageLocal stores the job template as file in a
+	// local directory
+	JobTemplateStorageLocal = "local"
+)
+
+const (
+	// LabelJobTemplateStorage is the job label which contains the
+	// storage backend of the job template
+	LabelJobTemplateStorage = "drmaa2jobtemplate"
+	// LabelJobTemplateBucket is the job label which contains the GCS
+	// bucket of the job template (JobTemplateStorageGCS)
+	LabelJobTemplateBucket = "drmaa2jobtemplatebucket"
+
+	compressedPrefix = "gzip:"
+	gcsPrefix        = "gs://"
+	filePrefix       = "file://"
+	// jobTemplateObjectPrefix is the path of job templates in a bucket
+	jobTemplateObjectPrefix = "drmaa2/jobtemplates/"
+)
+
+// SetJobTemplateStorage defines where the job templates of new jobs are
+// stored. For JobTemplateStorageGCS the location is the bucket (like
+// "gs://mybucket"), for JobTemplateStorageLocal the location is the
+// directory. For the other storage types the location is ignored.
+func (t *GCPBatchTracker) SetJobTemplateStorage(storage, location string) error {
+	switch storage {
+	case JobTemplateStorageEnv, JobTemplateStorageCompressedEnv:
+		location = ""
+	case JobTemplateStorageGCS:
+		if !strings.HasPrefix(location, gcsPrefix) {
+			return fmt.Errorf("job template storage location %s is not a GCS bucket (has no gs:// prefix)",
+				location)
+		}
+		bucket := strings.TrimSuffix(strings.TrimPrefix(location, gcsPrefix), "/")
+		if bucket == "" || strings.Contains(bucket, "/") {
+			return fmt.Errorf("job template storage location %s is not a GCS bucket (gs://<bucket>)",
+				location)
+		}
+		if _, complete := DecodeLabelValue(EncodeLabelValue(bucket)); !complete {
+			return fmt.Errorf("job template storage bucket %s is too long for the job label", bucket)
+		}
+		location = gcsPrefix + bucket
+	case JobTemplateStorageLocal:
+		dir, err := filepath.Abs(location)
+		if err != nil {
+			return fmt.Errorf("invalid job template storage directory %s: %v", location, err)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("could not create job template storage directory %s: %v", dir, err)
+		}
+		location = dir
+	default:
+		return fmt.Errorf("unknown job template storage: %s", storage)
+	}
+	t.jobTemplateStorage = storage
+	t.jobTemplateStorageLocation = location
+	return nil
+}
+
+// storeJobTemplates replaces the job templates in the environment of all
+// task groups of the job request by the configured storage backend. It
+// returns the references of the stored GCS objects and local files.
+func (t *GCPBatchTracker) storeJobTemplates(req *batchpb.CreateJobRequest) ([]string, error) {
+	if t.jobTemplateStorage == "" || t.jobTemplateStorage == JobTemplateStorageEnv {
+		return nil, nil
+	}
+	var references []string
+	for i, group := range req.Job.GetTaskGroups() {
+		variables := group.GetTaskSpec().GetEnvironment().GetVariables()
+		value, exists := variables[EnvJobTemplate]
+		if !exists {
+			continue
+		}
+		jt, err := GetJobTemplateFromBase64(value)
+		if err != nil {
+			t.deleteJobTemplates(references)
+			return nil, err
+		}
+		reference, err := storeJobTemplate(t.jobTemplateStorage,
+			t.jobTemplateStorageLocation, jobTemplateName(req.JobId, i), jt)
+		if err != nil {
+			t.deleteJobTemplates(references)
+			return nil, fmt.Errorf("could not store job template: %v", err)
+		}
+		switch t.jobTemplateStorage {
+		case JobTemplateStorageGCS:
+			// referenced by the job labels
+			delete(variables, EnvJobTemplate)
+			references = append(references, reference)
+		case JobTemplateStorageLocal:
+			variables[EnvJobTemplate] = reference
+			references = append(references, reference)
+		default:
+			variables[EnvJobTemplate] = reference
+		}
+	}
+	if req.Job.Labels == nil {
+		req.Job.Labels = make(map[string]string)
+	}
+	req.Job.Labels[LabelJobTemplateStorage] = t.jobTemplateStorage
+	if t.jobTemplateStorage == JobTemplateStorageGCS {
+		req.Job.Labels[LabelJobTemplateBucket] = EncodeLabelValue(
+			strings.TrimPrefix(t.jobTemplateStorageLocation, gcsPrefix))
+	}
+	return references, nil
+}
+
+// deleteJobTemplates removes the stored job templates of a job which
+// could not be created.
+func (t *GCPBatchTracker) deleteJobTemplates(references []string) {
+	for _, reference := range references {
+		switch {
+		case strings.HasPrefix(reference, gcsPrefix):
+			bucket, object, _ := strings.Cut(strings.TrimPrefix(reference, gcsPrefix), "/")
+			DeleteFileInBucket(gcsPrefix+bucket, object)
+		case strings.HasPrefix(reference, filePrefix):
+			os.Remove(strings.TrimPrefix(reference, filePrefix))
+		}
+	}
+}
+
+// createJobWithJobTemplates stores the job templates of the job request
+// and creates the job. The stored job templates are removed when the
+// job was not created.
+func (t *GCPBatchTracker) createJobWithJobTemplates(req *batchpb.CreateJobRequest) (string, error) {
+	if t.jobTemplateStorage == JobTemplateStorageGCS || t.jobTemplateStorage == JobTemplateStorageLocal {
+		// the stored job template of an existing job with the same
+		// job ID must not be replaced
+		existing, err := t.getJob(req.Parent + "/jobs/" + req.JobId)
+		switch {
+		case err == nil && !t.idempotentSubmission:
+			return "", fmt.Errorf("job %s already exists", req.JobId)
+		case err == nil && t.drmaa2session != "" && !IsInJobSession(t.drmaa2session, existing):
+			return "", fmt.Errorf("job %s already exists in a different job session", req.JobId)
+		case err == nil:
+			return existing.Name, nil
+		case !errors.Is(err, ErrJobNotFound):
+			return "", fmt.Errorf("could not check if job %s exists: %w", req.JobId, err)
+		}
+	}
+	references, err := t.storeJobTemplates(req)
+	if err != nil {
+		return "", err
+	}
+	jobID, err := t.createJob(req)
+	if err != nil {
+		// the job might have been created by a failed call
+		t.jobs.invalidate(req.Parent + "/jobs/" + req.JobId)
+	}
+	// after transient errors the job might have been created
+	if err != nil && !errors.Is(err, ErrTransient) {
+		t.deleteJobTemplates(references)
+	}
+	return jobID, err
+}
+
+// jobTemplateName returns the name of the stored job template of the
+// task group of the job.
+func jobTemplateName(jobID string, group int) string {
+	return fmt.Sprintf("%s-%d", jobID, group)
+}
+
+// jobTemplateValue returns the value of the job template environment
+// variable of the task group or, for job templates stored in GCS, the
+// reference to the object in the bucket of the job labels.
+func jobTemplateValue(job *batchpb.Job, group int) (string, bool) {
+	if group >= len(job.GetTaskGroups()) {
+		return "", false
+	}
+	variables := job.GetTaskGroups()[group].GetTaskSpec().GetEnvironment().GetVariables()
+	if value, exists := variables[EnvJobTemplate]; exists {
+		return value, true
+	}
+	if job.GetLabels()[LabelJobTemplateStorage] != JobTemplateStorageGCS {
+		return "", false
+	}
+	bucket, complete := DecodeLabelValue(job.GetLabels()[LabelJobTemplateBucket])
+	if bucket == "" || !complete || job.GetName() == "" {
+		return "", false
+	}
+	return gcsPrefix + bucket + "/" + jobTemplateObjectPrefix +
+		jobTemplateName(path.Base(job.GetName()), group) + ".json", true
+}
+
+// storeJobTemplate stores the job template and returns the value of
+// the job template environment variable or the reference to the GCS
+// object.
+func storeJobTemplate(storage, location, name string, jt drmaa2interface.JobTemplate) (string, error) {
+	switch storage {
+	case JobTemplateStorageCompressedEnv:
+		return JobTemplateToCompressedEnv(jt)
+	case JobTemplateStorageGCS:
+		content, err := json.Marshal(jt)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal job template: %v", err)
+		}
+		object := jobTemplateObjectPrefix + name + ".json"
+		if err := WriteToBucket(location, object, content); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(location, "/") + "/" + object, nil
+	case JobTemplateStorageLocal:
+		content, err := json.Marshal(jt)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal job template: %v", err)
+		}
+		file := filepath.Join(location, name+".json")
+		if err := os.WriteFile(file, content, 0600); err != nil {
+			return "", fmt.Errorf("could not write job template file %s: %v", file, err)
+		}
+		return filePrefix + file, nil
+	}
+	return JobTemplateToEnv(jt)
+}
+
+// JobTemplateToCompressedEnv returns the job template gzip compressed
+// and base64 encoded with a "gzip:" prefix.
+func JobTemplateToCompressedEnv(jt drmaa2interface.JobTemplate) (string, error) {
+	jtBytes, err := json.Marshal(jt)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal job template: %v", err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(jtBytes); err != nil {
+		return "", fmt.Errorf("could not compress job template: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("could not compress job template: %v", err)
+	}
+	return compressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// GetJobTemplateFromEnv returns the job template from the value of
+// the job template environment variable. The value can be the base64
+// encoded job template, the compressed job template, or a reference
+// to a job template stored in a GCS bucket or a local file.
+func GetJobTemplateFromEnv(value string) (drmaa2interface.JobTemplate, error) {
+	var content []byte
+	var err error
+	switch {
+	case strings.HasPrefix(value, compressedPrefix):
+		content, err = decompress(strings.TrimPrefix(value, compressedPrefix))
+	case strings.HasPrefix(value, gcsPrefix):
+		bucket, object, found := strings.Cut(strings.TrimPrefix(value, gcsPrefix), "/")
+		if !found {
+			return drmaa2interface.JobTemplate{},
+				fmt.Errorf("invalid job template reference: %s", value)
+		}
+		content, err = ReadFromBucket(gcsPrefix+bucket, object)
+	case strings.HasPrefix(value, filePrefix):
+		content, err = os.ReadFile(strings.TrimPrefix(value, filePrefix))
+	default:
+		return GetJobTemplateFromBase64(value)
+	}
+	if err != nil {
+		return drmaa2interface.JobTemplate{},
+			fmt.Errorf("could not read job template: %v", err)
+	}
+	jt := drmaa2interface.JobTemplate{}
+	if err := json.Unmarshal(content, &jt); err != nil {
+		return jt, fmt.Errorf("could not unmarshal job template: %v", err)
+	}
+	return jt, nil
+}
+
+func decompress(b64 string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
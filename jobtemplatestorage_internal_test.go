@@ -0,0 +1,89 @@
+package gcpbatchtracker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ = Describe("Job template storage internals", func() {
+
+	jt := drmaa2interface.JobTemplate{
+		JobName:           "stored",
+		RemoteCommand:     "/bin/sh",
+		JobCategory:       "busybox",
+		CandidateMachines: []string{"e2-standard-4"},
+	}
+
+	It("should store the job templates in local files and remove them", func() {
+		tracker := &GCPBatchTracker{}
+		dir := GinkgoT().TempDir()
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageLocal, dir)).To(Succeed())
+		req, err := ConvertJobTemplateToJobRequest("session", "project", "location", jt)
+		Expect(err).To(BeNil())
+
+		references, err := tracker.storeJobTemplates(req)
+		Expect(err).To(BeNil())
+		file := filepath.Join(dir, "stored-0.json")
+		Expect(references).To(Equal([]string{"file://" + file}))
+		Expect(file).To(BeARegularFile())
+		Expect(req.Job.TaskGroups[0].TaskSpec.Environment.Variables[EnvJobTemplate]).
+			To(Equal("file://" + file))
+		Expect(req.Job.Labels[LabelJobTemplateStorage]).To(Equal(JobTemplateStorageLocal))
+
+		tracker.deleteJobTemplates(references)
+		_, err = os.Stat(file)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should not replace the stored job template of an existing job", func() {
+		tracker := &GCPBatchTracker{}
+		tracker.SetJobCacheTTL(DefaultJobCacheTTL)
+		dir := GinkgoT().TempDir()
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageLocal, dir)).To(Succeed())
+		req, err := ConvertJobTemplateToJobRequest("session", "project", "location", jt)
+		Expect(err).To(BeNil())
+		existing := proto.Clone(req.Job).(*batchpb.Job)
+		existing.Name = req.Parent + "/jobs/" + req.JobId
+		tracker.jobs.put(existing)
+
+		_, err = tracker.createJobWithJobTemplates(req)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("already exists"))
+
+		tracker.SetIdempotentSubmission(true)
+		jobID, err := tracker.createJobWithJobTemplates(req)
+		Expect(err).To(BeNil())
+		Expect(jobID).To(Equal(existing.Name))
+		Expect(filepath.Join(dir, "stored-0.json")).NotTo(BeAnExistingFile())
+	})
+
+	It("should reference job templates in GCS by the job labels", func() {
+		req, err := ConvertJobTemplateToJobRequest("session", "project", "location", jt)
+		Expect(err).To(BeNil())
+		job := req.Job
+		job.Name = req.Parent + "/jobs/" + req.JobId
+		delete(job.TaskGroups[0].TaskSpec.Environment.Variables, EnvJobTemplate)
+		job.Labels[LabelJobTemplateStorage] = JobTemplateStorageGCS
+		job.Labels[LabelJobTemplateBucket] = EncodeLabelValue("my.bucket")
+
+		value, exists := jobTemplateValue(job, 0)
+		Expect(exists).To(BeTrue())
+		Expect(value).To(Equal("gs://my.bucket/drmaa2/jobtemplates/stored-0.json"))
+		_, exists = jobTemplateValue(job, 1)
+		Expect(exists).To(BeFalse())
+
+		delete(job.Labels, LabelJobTemplateBucket)
+		_, exists = jobTemplateValue(job, 0)
+		Expect(exists).To(BeFalse())
+		Expect(strings.HasPrefix(value, gcsPrefix)).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,74 @@
+package gcpbatchtracker_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Jobtemplatestorage", func() {
+
+	jt := drmaa2interface.JobTemplate{
+		RemoteCommand: "/bin/sh",
+		Args:          []string{"-c", strings.Repeat("echo hello; ", 100)},
+		JobCategory:   "busybox",
+	}
+
+	It("should read compressed job templates", func() {
+		compressed, err := JobTemplateToCompressedEnv(jt)
+		Expect(err).To(BeNil())
+		Expect(compressed).To(HavePrefix("gzip:"))
+		plain, err := JobTemplateToEnv(jt)
+		Expect(err).To(BeNil())
+		Expect(len(compressed)).To(BeNumerically("<", len(plain)))
+
+		decoded, err := GetJobTemplateFromEnv(compressed)
+		Expect(err).To(BeNil())
+		Expect(decoded).To(Equal(jt))
+
+		decoded, err = GetJobTemplateFromEnv(plain)
+		Expect(err).To(BeNil())
+		Expect(decoded).To(Equal(jt))
+
+		_, err = GetJobTemplateFromEnv("gzip:invalid")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should read job templates referenced in the job info", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "job.json")
+		_, err := GetJobTemplateFromEnv("file://" + file)
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.WriteFile(file, []byte(`{"remoteCommand":"/bin/sh","jobCategory":"busybox"}`), 0600)).To(Succeed())
+
+		ji := drmaa2interface.JobInfo{}
+		ji.ExtensionList = map[string]string{
+			ExtensionJobInfoJobTemplate: "file://" + file,
+		}
+		stored, exists := GetJobTemplateExtensionFromJobInfo(ji)
+		Expect(exists).To(BeTrue())
+		Expect(stored.RemoteCommand).To(Equal("/bin/sh"))
+		Expect(stored.JobCategory).To(Equal("busybox"))
+	})
+
+	It("should validate the job template storage settings", func() {
+		tracker := &GCPBatchTracker{}
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageEnv, "")).To(Succeed())
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageCompressedEnv, "")).To(Succeed())
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageGCS, "mybucket")).NotTo(Succeed())
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageGCS, "gs://mybucket")).To(Succeed())
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageGCS, "gs://mybucket/")).To(Succeed())
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageGCS, "gs://mybucket/path")).NotTo(Succeed())
+		dir := filepath.Join(GinkgoT().TempDir(), "templates")
+		Expect(tracker.SetJobTemplateStorage(JobTemplateStorageLocal, dir)).To(Succeed())
+		Expect(dir).To(BeADirectory())
+		Expect(tracker.SetJobTemplateStorage("unknown", "")).NotTo(Succeed())
+	})
+
+})
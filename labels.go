@@ -0,0 +1,307 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+)
+
+// Google Cloud label values must be lowercase, at most 63 characters
+// long, and can only contain letters, digits, "_", and "-". Values like
+// the AccountingID or the job session name are therefore encoded:
+// valid values are used as they are, other values get a "_" prefix and
+// all characters besides lowercase letters, digits, and "-" are escaped
+// as "_" followed by the hex code of the byte ("Team A" becomes
+// "__54eam_20_41"). Values which are too long after encoding are
+// truncated and get a hash suffix ("_z" followed by 8 hex digits) so
+// that they can't be decoded anymore.
+
+const (
+	// LabelOrigin marks jobs submitted by DRMAA2
+	LabelOrigin = "origin"
+	// LabelAccounting contains the encoded AccountingID
+	LabelAccounting = "accounting"
+	// LabelSession contains the encoded job session name
+	LabelSession = "drmaa2session"
+	// LabelQueue contains the encoded QueueName of the job template
+	LabelQueue = "drmaa2queue"
+	// LabelOwner contains the encoded name of the user who submitted
+	// the job
+	LabelOwner = "drmaa2owner"
+
+	maxLabelLength = 63
+	// maxLabels is the maximum amount of labels of a job
+	maxLabels = 64
+	// truncatedMarker separates a truncated label value from its hash
+	truncatedMarker = "_z"
+)
+
+// reservedLabels are set by gcpbatchtracker and can't be used as
+// user labels.
+var reservedLabels = map[string]bool{
+	LabelOrigin:             true,
+	LabelAccounting:         true,
+	LabelSession:            true,
+	LabelQueue:              true,
+	LabelOwner:              true,
+	LabelJobTemplateStorage: true,
+	LabelJobTemplateBucket:  true,
+}
+
+// EncodeLabelValue returns a valid Google Cloud label value for the
+// given value. If the value is longer than 63 characters after encoding,
+// it is truncated and can't be decoded anymore.
+func EncodeLabelValue(value string) string {
+	if isValidLabelValue(value) && !strings.HasPrefix(value, "_") {
+		return value
+	}
+	var encoded strings.Builder
+	encoded.WriteString("_")
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		var escaped string
+		if isLabelChar(c) && c != '_' {
+			escaped = string(c)
+		} else {
+			escaped = fmt.Sprintf("_%02x", c)
+		}
+		if encoded.Len()+len(escaped) > maxLabelLength {
+			return truncateLabelValue(encoded.String(), value)
+		}
+		encoded.WriteString(escaped)
+	}
+	return encoded.String()
+}
+
+// truncateLabelValue shortens the encoded value so that the hash
+// of the original value fits into the label value.
+func truncateLabelValue(encoded, value string) string {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	suffix := fmt.Sprintf("%s%08x", truncatedMarker, h.Sum32())
+	prefix := encoded[:maxLabelLength-len(suffix)]
+	// don't cut an escape sequence
+	if i := strings.LastIndex(prefix, "_"); i > 0 && len(prefix)-i < 3 {
+		prefix = prefix[:i]
+	}
+	return prefix + suffix
+}
+
+// DecodeLabelValue returns the original value of a label value which
+// was encoded by EncodeLabelValue(). If the value was truncated the
+// decoded prefix and false are returned.
+func DecodeLabelValue(label string) (string, bool) {
+	if !strings.HasPrefix(label, "_") {
+		return label, true
+	}
+	var decoded strings.Builder
+	for i := 1; i < len(label); i++ {
+		if label[i] != '_' {
+			decoded.WriteByte(label[i])
+			continue
+		}
+		if strings.HasPrefix(label[i:], truncatedMarker) {
+			return decoded.String(), false
+		}
+		if i+3 > len(label) {
+			return decoded.String(), false
+		}
+		c, err := strconv.ParseUint(label[i+1:i+3], 16, 8)
+		if err != nil {
+			return decoded.String(), false
+		}
+		decoded.WriteByte(byte(c))
+		i += 2
+	}
+	return decoded.String(), true
+}
+
+func isLabelChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+func isValidLabelValue(value string) bool {
+	if len(value) > maxLabelLength {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if !isLabelChar(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateLabelKey checks if the key is a valid Google Cloud label key
+// which is not reserved by gcpbatchtracker.
+func ValidateLabelKey(key string) error {
+	if reservedLabels[key] {
+		return fmt.Errorf("label %s is reserved", key)
+	}
+	if key == "" || len(key) > maxLabelLength || key[0] < 'a' || key[0] > 'z' {
+		return fmt.Errorf("label key %s must start with a lowercase letter and have at most %d characters",
+			key, maxLabelLength)
+	}
+	if !isValidLabelValue(key) {
+		return fmt.Errorf("label key %s must only contain lowercase letters, digits, _, and -", key)
+	}
+	return nil
+}
+
+// SetLabelsExtension sets user defined labels which are added to the
+// job and to the VMs of the job (like for billing breakdowns). The
+// label values are encoded like the AccountingID.
+func SetLabelsExtension(jt drmaa2interface.JobTemplate, labels map[string]string) (drmaa2interface.JobTemplate, error) {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	b64Labels, err := encodeExtensionMap(labels)
+	if err != nil {
+		return jt, fmt.Errorf("could not encode labels: %v", err)
+	}
+	jt.ExtensionList[ExtensionLabels] = b64Labels
+	return jt, nil
+}
+
+func GetLabelsExtension(jt drmaa2interface.JobTemplate) (map[string]string, bool) {
+	if jt.ExtensionList == nil {
+		return nil, false
+	}
+	labels, exists := jt.ExtensionList[ExtensionLabels]
+	if !exists {
+		return nil, false
+	}
+	return decodeExtensionMap(labels)
+}
+
+// validateLabels checks the user defined labels of the job template.
+func validateLabels(jt drmaa2interface.JobTemplate) error {
+	if _, exists := jt.ExtensionList[ExtensionLabels]; !exists {
+		return nil
+	}
+	labels, ok := GetLabelsExtension(jt)
+	if !ok {
+		return fmt.Errorf("could not decode labels extension")
+	}
+	if len(labels)+len(reservedLabels) > maxLabels {
+		return fmt.Errorf("too many labels (max. %d)", maxLabels-len(reservedLabels))
+	}
+	for _, key := range sortedKeys(labels) {
+		if err := ValidateLabelKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobLabels returns the labels of the job and of the allocation policy.
+func jobLabels(session string, jt drmaa2interface.JobTemplate) map[string]string {
+	labels := map[string]string{
+		LabelOrigin:     "go-drmaa2",
+		LabelAccounting: EncodeLabelValue(jt.AccountingID),
+		LabelSession:    EncodeLabelValue(session),
+	}
+	if jt.QueueName != "" {
+		labels[LabelQueue] = EncodeLabelValue(jt.QueueName)
+	}
+	if owner, _ := GetJobOwnerExtension(jt); owner != "" {
+		labels[LabelOwner] = EncodeLabelValue(owner)
+	}
+	user, _ := GetLabelsExtension(jt)
+	for key, value := range user {
+		labels[key] = EncodeLabelValue(value)
+	}
+	return labels
+}
+
+// currentUser returns the name of the user running the process or ""
+// if it can't be determined.
+func currentUser() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return current.Username
+}
+
+func SetJobOwnerExtension(jt drmaa2interface.JobTemplate, owner string) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionJobOwner] = owner
+	return jt
+}
+
+func GetJobOwnerExtension(jt drmaa2interface.JobTemplate) (string, bool) {
+	if jt.ExtensionList == nil {
+		return "", false
+	}
+	owner, exists := jt.ExtensionList[ExtensionJobOwner]
+	return owner, exists
+}
+
+// SetJobOwner sets the owner of all jobs whose job templates do not set
+// the job owner extension (like the user of a web service on whose
+// behalf the jobs are submitted). New trackers use the name of the user
+// running the process. An empty owner sets no owner label.
+func (t *GCPBatchTracker) SetJobOwner(owner string) {
+	t.jobOwner = owner
+}
+
+// applyJobOwner sets the job owner of the tracker in the job template
+// if the job template does not define one.
+func (t *GCPBatchTracker) applyJobOwner(jt drmaa2interface.JobTemplate) drmaa2interface.JobTemplate {
+	if t.jobOwner == "" {
+		return jt
+	}
+	if _, exists := GetJobOwnerExtension(jt); exists {
+		return jt
+	}
+	// don't modify the extension list of the caller
+	extensions := make(map[string]string, len(jt.ExtensionList)+1)
+	for k, v := range jt.ExtensionList {
+		extensions[k] = v
+	}
+	jt.ExtensionList = extensions
+	return SetJobOwnerExtension(jt, t.jobOwner)
+}
+
+// userLabels returns the decoded labels of the job which are not
+// set by gcpbatchtracker.
+func userLabels(labels map[string]string) map[string]string {
+	var user map[string]string
+	for key, value := range labels {
+		if reservedLabels[key] {
+			continue
+		}
+		if user == nil {
+			user = make(map[string]string)
+		}
+		user[key], _ = DecodeLabelValue(value)
+	}
+	return user
+}
+
+// accountingID returns the AccountingID of the job. If the label value
+// was truncated, the AccountingID is taken from the stored job template.
+func accountingID(job *batchpb.Job) string {
+	accounting, decoded := DecodeLabelValue(job.Labels[LabelAccounting])
+	if decoded {
+		return accounting
+	}
+	for i := range job.GetTaskGroups() {
+		value, exists := jobTemplateValue(job, i)
+		if !exists {
+			continue
+		}
+		if jt, err := GetJobTemplateFromEnv(value); err == nil {
+			return jt.AccountingID
+		}
+	}
+	return job.Labels[LabelAccounting]
+}
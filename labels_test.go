@@ -0,0 +1,116 @@
+package gcpbatchtracker_test
+
+import (
+	"strings"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Labels", func() {
+
+	Context("Label values", func() {
+
+		It("should keep valid label values", func() {
+			for _, value := range []string{"", "project-a", "team_1"} {
+				Expect(EncodeLabelValue(value)).To(Equal(value))
+				decoded, ok := DecodeLabelValue(value)
+				Expect(ok).To(BeTrue())
+				Expect(decoded).To(Equal(value))
+			}
+		})
+
+		It("should encode invalid label values reversible", func() {
+			Expect(EncodeLabelValue("Team A")).To(Equal("__54eam_20_41"))
+			for _, value := range []string{"Team A", "_hidden", "cost.center/42", "Überweisung",
+				strings.Repeat("a", 63), strings.Repeat("A", 20)} {
+				encoded := EncodeLabelValue(value)
+				Expect(len(encoded)).To(BeNumerically("<=", 63))
+				Expect(encoded).To(MatchRegexp("^[a-z0-9_-]*$"))
+				decoded, ok := DecodeLabelValue(encoded)
+				Expect(ok).To(BeTrue())
+				Expect(decoded).To(Equal(value))
+			}
+		})
+
+		It("should truncate long label values", func() {
+			value := strings.Repeat("A", 64)
+			encoded := EncodeLabelValue(value)
+			Expect(len(encoded)).To(BeNumerically("<=", 63))
+			Expect(encoded).To(MatchRegexp("^[a-z0-9_-]*$"))
+			Expect(EncodeLabelValue(value + "B")).NotTo(Equal(encoded))
+			decoded, ok := DecodeLabelValue(encoded)
+			Expect(ok).To(BeFalse())
+			Expect(value).To(HavePrefix(decoded))
+		})
+
+	})
+
+	Context("Job labels", func() {
+
+		jt := drmaa2interface.JobTemplate{
+			JobName:           "labels",
+			JobCategory:       "busybox",
+			AccountingID:      "Cost Center 42",
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+
+		It("should set sanitized and user defined labels", func() {
+			jt, err := SetLabelsExtension(jt, map[string]string{
+				"team":        "Research",
+				"cost-center": "42",
+			})
+			Expect(err).To(BeNil())
+			req, err := ConvertJobTemplateToJobRequest("My Session", "project", "location", jt)
+			Expect(err).To(BeNil())
+			for _, labels := range []map[string]string{req.Job.Labels, req.Job.AllocationPolicy.Labels} {
+				Expect(labels).To(HaveKeyWithValue(LabelAccounting, EncodeLabelValue("Cost Center 42")))
+				Expect(labels).To(HaveKeyWithValue(LabelSession, EncodeLabelValue("My Session")))
+				Expect(labels).To(HaveKeyWithValue("team", EncodeLabelValue("Research")))
+				Expect(labels).To(HaveKeyWithValue("cost-center", "42"))
+			}
+			Expect(IsInJobSession("My Session", req.Job)).To(BeTrue())
+
+			job := req.Job
+			job.Name = req.Parent + "/jobs/" + req.JobId
+			job.Status = &batchpb.JobStatus{}
+			ji, err := BatchJobToJobInfo("project", job)
+			Expect(err).To(BeNil())
+			Expect(ji.Annotation).To(Equal("Cost Center 42"))
+
+			delete(job.TaskGroups[0].TaskSpec.Environment.Variables, EnvJobTemplate)
+			converted, err := BatchJobToJobTemplate(job)
+			Expect(err).To(BeNil())
+			Expect(converted.AccountingID).To(Equal("Cost Center 42"))
+			labels, exists := GetLabelsExtension(converted)
+			Expect(exists).To(BeTrue())
+			Expect(labels).To(Equal(map[string]string{"team": "Research", "cost-center": "42"}))
+		})
+
+		It("should return the AccountingID of truncated labels from the job template", func() {
+			jt := jt
+			jt.AccountingID = strings.Repeat("Long Accounting ID ", 10)
+			req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(BeNil())
+			req.Job.Status = &batchpb.JobStatus{}
+			ji, err := BatchJobToJobInfo("project", req.Job)
+			Expect(err).To(BeNil())
+			Expect(ji.Annotation).To(Equal(jt.AccountingID))
+		})
+
+		It("should reject invalid label keys", func() {
+			for _, key := range []string{"Team", "1team", "accounting", "team.name", ""} {
+				jt, err := SetLabelsExtension(jt, map[string]string{key: "value"})
+				Expect(err).To(BeNil())
+				_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+				Expect(err).To(HaveOccurred(), key)
+			}
+		})
+
+	})
+
+})
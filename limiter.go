@@ -0,0 +1,328 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SubmissionLimits throttle the job submission of a tracker so that
+// mass submissions (like job arrays submitted as single jobs) don't
+// exceed the Google Batch API rate limits. Zero values don't limit.
+type SubmissionLimits struct {
+	// CallsPerSecond is the rate of CreateJob API calls
+	CallsPerSecond float64
+	// Burst is the amount of CreateJob calls which can be made at once
+	// (at least 1)
+	Burst int
+	// MaxInFlightJobs is the maximum amount of queued and running jobs
+	// of the job session. AddJob() blocks until a job has finished.
+	MaxInFlightJobs int
+	// InFlightPollInterval is the interval in which the amount of
+	// queued and running jobs is checked while AddJob() is blocked
+	InFlightPollInterval time.Duration
+	// MaxRetries is the amount of retries of API calls which failed
+	// with a transient error (like RESOURCE_EXHAUSTED or UNAVAILABLE)
+	MaxRetries int
+	// InitialBackoff is the waiting time before the first retry which
+	// is doubled for each further retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultSubmissionLimits are the submission limits of new trackers:
+// no rate limits but retries of rate limited API calls.
+var DefaultSubmissionLimits = SubmissionLimits{
+	MaxRetries:           5,
+	InitialBackoff:       1 * time.Second,
+	MaxBackoff:           32 * time.Second,
+	InFlightPollInterval: 10 * time.Second,
+}
+
+// Backoff returns the waiting time before the given retry (starting
+// with 0 for the first retry).
+func (l SubmissionLimits) Backoff(retry int) time.Duration {
+	backoff := l.InitialBackoff
+	for i := 0; i < retry && (l.MaxBackoff <= 0 || backoff < l.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if l.MaxBackoff > 0 && backoff > l.MaxBackoff {
+		return l.MaxBackoff
+	}
+	return backoff
+}
+
+// SubmissionMetrics are the counters of the job submissions of a
+// tracker.
+type SubmissionMetrics struct {
+	// Submitted is the amount of jobs which were created
+	Submitted uint64
+	// Throttled is the amount of CreateJob calls which were delayed by
+	// the rate limit or the in-flight limit
+	Throttled uint64
+	// ThrottledTime is the sum of the delays
+	ThrottledTime time.Duration
+	// Retries is the amount of retried CreateJob calls
+	Retries uint64
+	// Failed is the amount of CreateJob calls which failed after all
+	// retries
+	Failed uint64
+}
+
+// TokenBucket is a rate limiter which allows a burst of calls and then
+// calls with the given rate.
+type TokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a rate limiter for the given calls per second.
+func NewTokenBucket(callsPerSecond float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   callsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until the call is allowed and returns the waiting time.
+func (b *TokenBucket) Wait(ctx context.Context) (time.Duration, error) {
+	wait := b.reserve(time.Now())
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is
+// available.
+func (b *TokenBucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// submissionLimiter throttles the CreateJob calls of a tracker.
+type submissionLimiter struct {
+	limits SubmissionLimits
+	bucket *TokenBucket
+
+	mutex   sync.Mutex
+	metrics SubmissionMetrics
+	// inFlight is the amount of queued and running jobs of the job
+	// session when it was last checked plus the jobs submitted since
+	inFlight int
+	// inFlightKnown is false until the jobs are counted the first time
+	inFlightKnown bool
+}
+
+func newSubmissionLimiter(limits SubmissionLimits) *submissionLimiter {
+	return &submissionLimiter{
+		limits: limits,
+		bucket: NewTokenBucket(limits.CallsPerSecond, limits.Burst),
+	}
+}
+
+// SetSubmissionLimits sets the limits for the job submission of the
+// tracker (see DefaultSubmissionLimits). Jobs which are submitted at
+// the same time keep using the previous limits.
+func (t *GCPBatchTracker) SetSubmissionLimits(limits SubmissionLimits) {
+	t.limiterMutex.Lock()
+	defer t.limiterMutex.Unlock()
+	t.limiter = newSubmissionLimiter(limits)
+}
+
+// submissionLimiter returns the current submission limiter of the
+// tracker (nil if the tracker has none).
+func (t *GCPBatchTracker) submissionLimiter() *submissionLimiter {
+	t.limiterMutex.Lock()
+	defer t.limiterMutex.Unlock()
+	return t.limiter
+}
+
+// SubmissionMetrics returns the counters of the job submissions.
+func (t *GCPBatchTracker) SubmissionMetrics() SubmissionMetrics {
+	l := t.submissionLimiter()
+	if l == nil {
+		return SubmissionMetrics{}
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.metrics
+}
+
+func (l *submissionLimiter) throttled(wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.metrics.Throttled++
+	l.metrics.ThrottledTime += wait
+}
+
+func (l *submissionLimiter) count(counter *uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	*counter++
+}
+
+// waitForInFlightSlot blocks until less than MaxInFlightJobs jobs of
+// the job session are queued or running and reserves a slot for the
+// new job. The jobs are only counted again when the limit is reached.
+func (l *submissionLimiter) waitForInFlightSlot(ctx context.Context, countJobs func() (int, error)) error {
+	if l.limits.MaxInFlightJobs <= 0 {
+		return nil
+	}
+	var waited time.Duration
+	defer func() { l.throttled(waited) }()
+	for {
+		l.mutex.Lock()
+		if l.inFlightKnown && l.inFlight < l.limits.MaxInFlightJobs {
+			l.inFlight++
+			l.mutex.Unlock()
+			return nil
+		}
+		l.mutex.Unlock()
+
+		count, err := countJobs()
+		if err != nil {
+			return err
+		}
+		l.mutex.Lock()
+		l.inFlight, l.inFlightKnown = count, true
+		if l.inFlight < l.limits.MaxInFlightJobs {
+			l.inFlight++
+			l.mutex.Unlock()
+			return nil
+		}
+		l.mutex.Unlock()
+
+		interval := l.limits.InFlightPollInterval
+		if interval <= 0 {
+			interval = DefaultSubmissionLimits.InFlightPollInterval
+		}
+		select {
+		case <-time.After(interval):
+			waited += interval
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseInFlightSlot frees the slot of a job which was not created.
+func (l *submissionLimiter) releaseInFlightSlot() {
+	if l.limits.MaxInFlightJobs <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+}
+
+// activeJobCount returns the amount of queued and running jobs of
+// the job session.
+func (t *GCPBatchTracker) activeJobCount() (int, error) {
+	jobs, err := t.sessionJobs(true)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, job := range jobs {
+		if isActiveJob(job) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// createJobFunc is the CreateJob call of the Google Batch API.
+type createJobFunc func(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, error)
+
+// submitJob calls CreateJob within the submission limits and retries
+// rate limited calls. The returned bool is true if the job was
+// created by a retry.
+func (t *GCPBatchTracker) submitJob(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, bool, error) {
+	create := t.createJobCall
+	if create == nil {
+		create = func(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, error) {
+			return t.client.CreateJob(ctx, req)
+		}
+	}
+	l := t.submissionLimiter()
+	if l == nil {
+		job, err := create(ctx, req)
+		return job, false, classifyError(err)
+	}
+	return l.submit(ctx, req, create, t.activeJobCount)
+}
+
+// submit calls create within the limits and retries transient errors.
+// countJobs returns the amount of queued and running jobs of the job
+// session (see waitForInFlightSlot()). The returned bool is true if the
+// job was created (or failed) in a retry.
+func (l *submissionLimiter) submit(ctx context.Context, req *batchpb.CreateJobRequest, create createJobFunc, countJobs func() (int, error)) (*batchpb.Job, bool, error) {
+	if err := l.waitForInFlightSlot(ctx, countJobs); err != nil {
+		return nil, false, err
+	}
+	for retry := 0; ; retry++ {
+		wait, err := l.bucket.Wait(ctx)
+		if err != nil {
+			l.releaseInFlightSlot()
+			return nil, retry > 0, err
+		}
+		l.throttled(wait)
+		job, err := create(ctx, req)
+		if err == nil {
+			l.count(&l.metrics.Submitted)
+			return job, retry > 0, nil
+		}
+		if !isTransient(err) || retry >= l.limits.MaxRetries {
+			l.count(&l.metrics.Failed)
+			if status.Code(err) != codes.AlreadyExists {
+				l.releaseInFlightSlot()
+			}
+			return nil, retry > 0, classifyError(err)
+		}
+		l.count(&l.metrics.Retries)
+		select {
+		case <-time.After(l.limits.Backoff(retry)):
+		case <-ctx.Done():
+			l.releaseInFlightSlot()
+			return nil, true, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Submission limiter internals", func() {
+
+	req := &batchpb.CreateJobRequest{
+		Parent: "projects/p/locations/us-central1",
+		JobId:  "job1",
+		Job:    &batchpb.Job{},
+	}
+	jobName := req.Parent + "/jobs/" + req.JobId
+
+	// createFailing returns a create function which fails with the
+	// given errors before it creates the job
+	createFailing := func(calls *int, errs ...error) createJobFunc {
+		return func(ctx context.Context, req *batchpb.CreateJobRequest) (*batchpb.Job, error) {
+			*calls++
+			if *calls <= len(errs) {
+				return nil, errs[*calls-1]
+			}
+			return &batchpb.Job{Name: req.Parent + "/jobs/" + req.JobId}, nil
+		}
+	}
+
+	noJobs := func() (int, error) { return 0, nil }
+
+	limits := SubmissionLimits{
+		MaxRetries:      2,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		MaxInFlightJobs: 1,
+	}
+
+	// trackers can't count the jobs without client
+	retryLimits := limits
+	retryLimits.MaxInFlightJobs = 0
+
+	It("should retry transient errors", func() {
+		l := newSubmissionLimiter(limits)
+		calls := 0
+		job, retried, err := l.submit(context.Background(), req,
+			createFailing(&calls, status.Error(codes.Unavailable, "unavailable"),
+				status.Error(codes.ResourceExhausted, "quota")), noJobs)
+		Expect(err).To(BeNil())
+		Expect(job.Name).To(Equal(jobName))
+		Expect(retried).To(BeTrue())
+		Expect(calls).To(Equal(3))
+		Expect(l.metrics.Retries).To(Equal(uint64(2)))
+		Expect(l.metrics.Submitted).To(Equal(uint64(1)))
+		Expect(l.inFlight).To(Equal(1))
+	})
+
+	It("should give up after the max. retries and release the in-flight slot", func() {
+		l := newSubmissionLimiter(limits)
+		calls := 0
+		unavailable := status.Error(codes.Unavailable, "unavailable")
+		_, retried, err := l.submit(context.Background(), req,
+			createFailing(&calls, unavailable, unavailable, unavailable), noJobs)
+		Expect(errors.Is(err, ErrTransient)).To(BeTrue())
+		Expect(retried).To(BeTrue())
+		Expect(calls).To(Equal(3))
+		Expect(l.metrics.Failed).To(Equal(uint64(1)))
+		Expect(l.inFlight).To(Equal(0))
+	})
+
+	It("should not retry other errors", func() {
+		l := newSubmissionLimiter(limits)
+		calls := 0
+		_, retried, err := l.submit(context.Background(), req,
+			createFailing(&calls, status.Error(codes.InvalidArgument, "invalid")), noJobs)
+		Expect(err).To(HaveOccurred())
+		Expect(retried).To(BeFalse())
+		Expect(calls).To(Equal(1))
+		Expect(l.inFlight).To(Equal(0))
+
+		// the job exists, hence it keeps its in-flight slot
+		calls = 0
+		_, _, err = l.submit(context.Background(), req,
+			createFailing(&calls, status.Error(codes.AlreadyExists, "exists")), noJobs)
+		Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+		Expect(l.inFlight).To(Equal(1))
+	})
+
+	It("should count the jobs only when the in-flight limit is reached", func() {
+		l := newSubmissionLimiter(SubmissionLimits{
+			MaxInFlightJobs:      2,
+			InFlightPollInterval: time.Millisecond,
+		})
+		counted := 0
+		countJobs := func() (int, error) {
+			counted++
+			switch counted {
+			case 1:
+				return 0, nil
+			case 2:
+				// both submitted jobs are still queued
+				return 2, nil
+			}
+			return 1, nil
+		}
+		calls := 0
+		for i := 0; i < 3; i++ {
+			_, _, err := l.submit(context.Background(), req, createFailing(&calls), countJobs)
+			Expect(err).To(BeNil())
+		}
+		Expect(calls).To(Equal(3))
+		Expect(counted).To(Equal(3))
+		Expect(l.metrics.Throttled).To(Equal(uint64(1)))
+
+		_, _, err := l.submit(context.Background(), req, createFailing(&calls),
+			func() (int, error) { return 0, errors.New("list failed") })
+		Expect(err).To(MatchError("list failed"))
+	})
+
+	It("should return the existing job when it was created by a retry", func() {
+		calls := 0
+		tracker := &GCPBatchTracker{
+			limiter: newSubmissionLimiter(retryLimits),
+			createJobCall: createFailing(&calls,
+				status.Error(codes.Unavailable, "unavailable"),
+				status.Error(codes.AlreadyExists, "exists")),
+		}
+		tracker.SetJobCacheTTL(DefaultJobCacheTTL)
+		tracker.jobs.put(&batchpb.Job{Name: jobName})
+		jobID, err := tracker.createJob(req)
+		Expect(err).To(BeNil())
+		Expect(jobID).To(Equal(jobName))
+		Expect(calls).To(Equal(2))
+
+		// without retry the job exists from an earlier submission
+		calls = 0
+		tracker.createJobCall = createFailing(&calls,
+			status.Error(codes.AlreadyExists, "exists"))
+		_, err = tracker.createJob(req)
+		Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+
+		// unless the submission is idempotent
+		calls = 0
+		tracker.idempotentSubmission = true
+		jobID, err = tracker.createJob(req)
+		Expect(err).To(BeNil())
+		Expect(jobID).To(Equal(jobName))
+	})
+
+	It("should replace the limits while jobs are submitted", func() {
+		tracker := &GCPBatchTracker{
+			createJobCall: createFailing(new(int)),
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				tracker.SetSubmissionLimits(retryLimits)
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			_, _, err := tracker.submitJob(context.Background(), req)
+			Expect(err).To(BeNil())
+		}
+		<-done
+	})
+
+})
@@ -0,0 +1,68 @@
+package gcpbatchtracker_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Submission limiter", func() {
+
+	It("should double the backoff up to the max. backoff", func() {
+		limits := SubmissionLimits{
+			InitialBackoff: time.Second,
+			MaxBackoff:     10 * time.Second,
+		}
+		Expect(limits.Backoff(0)).To(Equal(time.Second))
+		Expect(limits.Backoff(1)).To(Equal(2 * time.Second))
+		Expect(limits.Backoff(3)).To(Equal(8 * time.Second))
+		Expect(limits.Backoff(4)).To(Equal(10 * time.Second))
+		Expect(limits.Backoff(100)).To(Equal(10 * time.Second))
+		Expect(DefaultSubmissionLimits.Backoff(0)).To(Equal(time.Second))
+	})
+
+	It("should allow a burst of calls and then limit the rate", func() {
+		bucket := NewTokenBucket(50, 2)
+		ctx := context.Background()
+		for i := 0; i < 2; i++ {
+			wait, err := bucket.Wait(ctx)
+			Expect(err).To(BeNil())
+			Expect(wait).To(BeZero())
+		}
+		wait, err := bucket.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(wait).To(BeNumerically(">", 10*time.Millisecond))
+		Expect(wait).To(BeNumerically("<=", 20*time.Millisecond))
+	})
+
+	It("should not limit without rate", func() {
+		bucket := NewTokenBucket(0, 0)
+		for i := 0; i < 100; i++ {
+			wait, err := bucket.Wait(context.Background())
+			Expect(err).To(BeNil())
+			Expect(wait).To(BeZero())
+		}
+	})
+
+	It("should stop waiting when the context is canceled", func() {
+		bucket := NewTokenBucket(0.001, 1)
+		_, err := bucket.Wait(context.Background())
+		Expect(err).To(BeNil())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = bucket.Wait(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("should return the submission metrics", func() {
+		tracker := &GCPBatchTracker{}
+		Expect(tracker.SubmissionMetrics()).To(Equal(SubmissionMetrics{}))
+		tracker.SetSubmissionLimits(SubmissionLimits{CallsPerSecond: 10, Burst: 5})
+		Expect(tracker.SubmissionMetrics()).To(Equal(SubmissionMetrics{}))
+	})
+
+})
@@ -0,0 +1,162 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"github.com/dgruber/drmaa2os/pkg/d2hlp"
+	"google.golang.org/api/iterator"
+)
+
+// ListJobsOptions defines which page of jobs ListJobsPage() returns.
+type ListJobsOptions struct {
+	// PageSize is the maximum amount of jobs of the page (0 is the
+	// Google Batch default)
+	PageSize int32
+	// PageToken is the NextPageToken of the previous page ("" for the
+	// first page)
+	PageToken string
+	// Filter restricts the jobs like the filter of GetAllJobIDs()
+	Filter *drmaa2interface.JobInfo
+	// AllSessions returns the jobs of all job sessions and not only
+	// the jobs of the job session of the tracker
+	AllSessions bool
+}
+
+// JobsPage is a page of jobs returned by ListJobsPage().
+type JobsPage struct {
+	JobInfos []drmaa2interface.JobInfo
+	// NextPageToken is the cursor for the next page ("" if this is the
+	// last page)
+	NextPageToken string
+}
+
+// SetListJobsPageSize sets the amount of jobs which are requested per
+// ListJobs call when listing all jobs (0 is the Google Batch default).
+func (t *GCPBatchTracker) SetListJobsPageSize(pageSize int32) {
+	t.listJobsPageSize = pageSize
+}
+
+// ListJobsPage returns one page of the jobs of the job session (like for
+// UIs). The NextPageToken of the page is the PageToken of the options
+// for the next page. As the JobInfo filter is partly applied on the
+// client side a page can contain less jobs than the page size even when
+// there are more pages.
+func (t *GCPBatchTracker) ListJobsPage(ctx context.Context, opts ListJobsOptions) (JobsPage, error) {
+	useJobSessionFilter := !opts.AllSessions
+	req := t.listJobsRequest(useJobSessionFilter, opts.Filter)
+	var jobs []*batchpb.Job
+	pager := iterator.NewPager(t.client.ListJobs(ctx, req),
+		int(opts.PageSize), opts.PageToken)
+	nextPageToken, err := pager.NextPage(&jobs)
+	if err != nil {
+		return JobsPage{}, fmt.Errorf("could not list jobs: %w", classifyError(err))
+	}
+	page := JobsPage{
+		JobInfos:      make([]drmaa2interface.JobInfo, 0, len(jobs)),
+		NextPageToken: nextPageToken,
+	}
+	for _, job := range jobs {
+		if ji, matches := t.matchJob(job, useJobSessionFilter, opts.Filter); matches {
+			page.JobInfos = append(page.JobInfos, ji)
+		}
+	}
+	return page, nil
+}
+
+// ListJobsFilter returns the Google Batch ListJobs filter expression
+// for the jobs of the job session (if session is not "") which match
+// the JobInfo filter (see BatchJobFilter()).
+func ListJobsFilter(session string, filter *drmaa2interface.JobInfo) string {
+	var expressions []string
+	if session != "" {
+		expressions = append(expressions, fmt.Sprintf("labels.%s=%q",
+			LabelSession, EncodeLabelValue(session)))
+	}
+	if expression := BatchJobFilter(filter); expression != "" {
+		expressions = append(expressions, expression)
+	}
+	return strings.Join(expressions, " AND ")
+}
+
+// listJobsRequest returns the ListJobs request for the jobs in the
+// location of the tracker.
+func (t *GCPBatchTracker) listJobsRequest(useJobSessionFilter bool, filter *drmaa2interface.JobInfo) *batchpb.ListJobsRequest {
+	session := ""
+	if useJobSessionFilter {
+		session = t.drmaa2session
+	}
+	return &batchpb.ListJobsRequest{
+		Parent: fmt.Sprintf("projects/%s/locations/%s", t.project, t.location),
+		Filter: ListJobsFilter(session, filter),
+	}
+}
+
+// matchJob checks the job session and the JobInfo filter on the client
+// side and caches matching jobs.
+func (t *GCPBatchTracker) matchJob(job *batchpb.Job, useJobSessionFilter bool, filter *drmaa2interface.JobInfo) (drmaa2interface.JobInfo, bool) {
+	// filter for jobsession, if job session is "" then all jobs are returned
+	if useJobSessionFilter && t.drmaa2session != "" {
+		if !IsInJobSession(t.drmaa2session, job) {
+			return drmaa2interface.JobInfo{}, false
+		}
+	}
+	ji, err := BatchJobToJobInfo(t.project, job)
+	if err != nil {
+		return drmaa2interface.JobInfo{ID: job.Name}, filter == nil
+	}
+	if filter != nil && !d2hlp.JobInfoMatches(ji, *filter) {
+		return ji, false
+	}
+	t.jobs.put(job)
+	return ji, true
+}
+
+// listBatchJobs returns all jobs of the ListJobs request. The listing is
+// restarted on transient errors.
+func (t *GCPBatchTracker) listBatchJobs(req *batchpb.ListJobsRequest) ([]*batchpb.Job, error) {
+	var jobs []*batchpb.Job
+	ctx := context.Background()
+	err := t.withRetry(ctx, func() error {
+		jobs = nil
+		iter := t.client.ListJobs(ctx, req)
+		for {
+			job, err := iter.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+	})
+	return jobs, err
+}
+
+// listTasks returns all tasks of the task group. The listing is
+// restarted on transient errors.
+func (t *GCPBatchTracker) listTasks(taskGroup string) ([]*batchpb.Task, error) {
+	var tasks []*batchpb.Task
+	ctx := context.Background()
+	err := t.withRetry(ctx, func() error {
+		tasks = nil
+		iter := t.client.ListTasks(ctx, &batchpb.ListTasksRequest{
+			Parent: taskGroup,
+		})
+		for {
+			task, err := iter.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+		}
+	})
+	return tasks, err
+}
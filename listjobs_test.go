@@ -0,0 +1,34 @@
+package gcpbatchtracker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("ListJobs", func() {
+
+	Context("ListJobsFilter", func() {
+
+		It("should filter for the job session label", func() {
+			Expect(ListJobsFilter("", nil)).To(Equal(""))
+			Expect(ListJobsFilter("session", nil)).To(Equal(
+				`labels.drmaa2session="session"`))
+			Expect(ListJobsFilter("My Session", nil)).To(Equal(
+				`labels.drmaa2session="` + EncodeLabelValue("My Session") + `"`))
+		})
+
+		It("should combine the job session and the JobInfo filter", func() {
+			filter := drmaa2interface.CreateJobInfo()
+			filter.State = drmaa2interface.Failed
+			Expect(ListJobsFilter("session", &filter)).To(Equal(
+				`labels.drmaa2session="session" AND status.state="FAILED"`))
+			Expect(ListJobsFilter("", &filter)).To(Equal(
+				`status.state="FAILED"`))
+		})
+
+	})
+
+})
@@ -0,0 +1,187 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/api/iterator"
+)
+
+// arm64Families are the machine families with Arm CPUs
+var arm64Families = []string{"t2a-", "c4a-"}
+
+// machineTypesTTL is the time the machine types of a location are
+// cached by a tracker.
+const machineTypesTTL = time.Hour
+
+// machineTypeCache keeps the machine types of the location of a tracker
+// so that not every GetAllMachines() call lists the machine types of
+// all zones.
+type machineTypeCache struct {
+	mutex   sync.Mutex
+	types   []MachineType
+	expires time.Time
+	// list replaces listMachineTypes() (for tests)
+	list func() ([]MachineType, error)
+}
+
+// machineTypes returns the cached machine types of the location of the
+// tracker or lists them when they are not cached or expired. Errors are
+// not cached.
+func (t *GCPBatchTracker) machineTypes() ([]MachineType, error) {
+	t.machines.mutex.Lock()
+	defer t.machines.mutex.Unlock()
+	if t.machines.types != nil && time.Now().Before(t.machines.expires) {
+		return t.machines.types, nil
+	}
+	list := t.listMachineTypes
+	if t.machines.list != nil {
+		list = t.machines.list
+	}
+	types, err := list()
+	if err != nil {
+		return nil, err
+	}
+	t.machines.types = types
+	t.machines.expires = time.Now().Add(machineTypesTTL)
+	return types, nil
+}
+
+// listMachineTypes returns the machine types which are available in the
+// zones of the location of the tracker by using the Compute Engine API.
+func (t *GCPBatchTracker) listMachineTypes() ([]MachineType, error) {
+	ctx := context.Background()
+	client, err := compute.NewMachineTypesRESTClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create compute client: %v", err)
+	}
+	defer client.Close()
+
+	types := make(map[string]MachineType)
+	it := client.AggregatedList(ctx, &computepb.AggregatedListMachineTypesRequest{
+		Project: t.project,
+	})
+	for {
+		pair, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not list machine types: %v", err)
+		}
+		if !isZoneInLocation(strings.TrimPrefix(pair.Key, "zones/"), t.location) {
+			continue
+		}
+		for _, machineType := range pair.Value.GetMachineTypes() {
+			if machineType.GetDeprecated() != nil {
+				continue
+			}
+			types[machineType.GetName()] = ComputeMachineTypeToMachineType(machineType)
+		}
+	}
+	machineTypes := make([]MachineType, 0, len(types))
+	for _, m := range types {
+		machineTypes = append(machineTypes, m)
+	}
+	return machineTypes, nil
+}
+
+// machineTypesOrCatalog returns the machine types of the location of the
+// tracker. If they can't be requested from the Compute Engine API (like
+// due to a missing compute.machineTypes.list permission) the machine
+// types of the embedded catalog are returned, which are not necessarily
+// available in the location. If the filter is not empty only the machine
+// types of the catalog with the given names (including custom machine
+// types) are returned.
+func (t *GCPBatchTracker) machineTypesOrCatalog(filter []string) []MachineType {
+	types, err := t.machineTypes()
+	if err == nil {
+		return types
+	}
+	if len(filter) == 0 {
+		return MachineTypes()
+	}
+	types = make([]MachineType, 0, len(filter))
+	for _, name := range filter {
+		if m, exists := GetMachineType(name); exists {
+			types = append(types, m)
+		}
+	}
+	return types
+}
+
+// isZoneInLocation returns true if the zone (like "us-central1-a") is
+// the location or is in the region of the location (like "us-central1").
+func isZoneInLocation(zone, location string) bool {
+	return zone == location || strings.HasPrefix(zone, location+"-")
+}
+
+// ComputeMachineTypeToMachineType converts a machine type of the Compute
+// Engine API.
+func ComputeMachineTypeToMachineType(machineType *computepb.MachineType) MachineType {
+	m := MachineType{
+		Name:      machineType.GetName(),
+		CPUs:      int64(machineType.GetGuestCpus()),
+		MemoryMiB: int64(machineType.GetMemoryMb()),
+	}
+	for _, accelerator := range machineType.GetAccelerators() {
+		m.GPUs += int64(accelerator.GetGuestAcceleratorCount())
+		m.GPUType = accelerator.GetGuestAcceleratorType()
+	}
+	return m
+}
+
+// MachineTypesToMachines converts machine types into DRMAA2 machines
+// sorted by name. If the filter is not empty only the machine types
+// with the names in the filter are returned. The vCPUs are reported as
+// cores of one socket, the memory in KiB. Built-in GPUs are stored in
+// the "accelerators" extension ("<count>*<type>").
+func MachineTypesToMachines(types []MachineType, filter []string) []drmaa2interface.Machine {
+	names := make(map[string]bool, len(filter))
+	for _, name := range filter {
+		names[name] = true
+	}
+	machines := make([]drmaa2interface.Machine, 0, len(types))
+	for _, m := range types {
+		if len(names) > 0 && !names[m.Name] {
+			continue
+		}
+		machine := drmaa2interface.Machine{
+			Name:           m.Name,
+			Available:      true,
+			Sockets:        1,
+			CoresPerSocket: m.CPUs,
+			ThreadsPerCore: 1,
+			PhysicalMemory: m.MemoryMiB * 1024,
+			Architecture:   machineArchitecture(m.Name),
+			OS:             drmaa2interface.Linux,
+		}
+		machine.ExtensionList = map[string]string{}
+		if m.GPUs > 0 {
+			machine.ExtensionList[ExtensionAccelerators] =
+				strconv.FormatInt(m.GPUs, 10) + "*" + m.GPUType
+		}
+		machines = append(machines, machine)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+	return machines
+}
+
+func machineArchitecture(machine string) drmaa2interface.CPU {
+	for _, family := range arm64Families {
+		if strings.HasPrefix(machine, family) {
+			return drmaa2interface.ARM64
+		}
+	}
+	return drmaa2interface.X64
+}
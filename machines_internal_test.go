@@ -0,0 +1,60 @@
+package gcpbatchtracker
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Machines internals", func() {
+
+	It("should return the cached machine types of the location", func() {
+		tracker := &GCPBatchTracker{location: "us-central1"}
+		tracker.machines.types = []MachineType{
+			{Name: "n2-standard-8", CPUs: 8, MemoryMiB: 32768},
+			{Name: "e2-standard-4", CPUs: 4, MemoryMiB: 16384},
+		}
+		tracker.machines.expires = time.Now().Add(time.Minute)
+		machines, err := tracker.GetAllMachines(nil)
+		Expect(err).To(BeNil())
+		Expect(machines).To(HaveLen(2))
+		Expect(machines[0].Name).To(Equal("e2-standard-4"))
+
+		machines, err = tracker.GetAllMachines([]string{"n2-standard-8"})
+		Expect(err).To(BeNil())
+		Expect(machines).To(HaveLen(1))
+		Expect(machines[0].CoresPerSocket).To(Equal(int64(8)))
+	})
+
+	It("should fall back to the machine type catalog when the Compute Engine API fails", func() {
+		listed := 0
+		tracker := &GCPBatchTracker{location: "us-central1"}
+		tracker.machines.list = func() ([]MachineType, error) {
+			listed++
+			return nil, errors.New("permission denied")
+		}
+		machines, err := tracker.GetAllMachines(nil)
+		Expect(err).To(BeNil())
+		Expect(machines).To(HaveLen(len(MachineTypes())))
+
+		machines, err = tracker.GetAllMachines([]string{"e2-standard-4", "custom-4-8192", "unknown"})
+		Expect(err).To(BeNil())
+		Expect(machines).To(HaveLen(2))
+		Expect(machines[0].Name).To(Equal("custom-4-8192"))
+		Expect(machines[0].PhysicalMemory).To(Equal(int64(8192 * 1024)))
+		Expect(machines[1].Name).To(Equal("e2-standard-4"))
+		// errors are not cached
+		Expect(listed).To(Equal(2))
+
+		multi := &MultiLocationTracker{
+			locations: []string{"us-central1"},
+			trackers:  map[string]*GCPBatchTracker{"us-central1": tracker},
+		}
+		machines, err = multi.GetAllMachines([]string{"e2-standard-4"})
+		Expect(err).To(BeNil())
+		Expect(machines).To(HaveLen(1))
+	})
+
+})
@@ -0,0 +1,57 @@
+package gcpbatchtracker_test
+
+import (
+	"cloud.google.com/go/compute/apiv1/computepb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Machines", func() {
+
+	It("should convert Compute Engine machine types", func() {
+		m := ComputeMachineTypeToMachineType(&computepb.MachineType{
+			Name:      proto.String("a2-highgpu-2g"),
+			GuestCpus: proto.Int32(24),
+			MemoryMb:  proto.Int32(174080),
+			Accelerators: []*computepb.Accelerators{
+				{
+					GuestAcceleratorType:  proto.String("nvidia-tesla-a100"),
+					GuestAcceleratorCount: proto.Int32(2),
+				},
+			},
+		})
+		Expect(m).To(Equal(MachineType{
+			Name:      "a2-highgpu-2g",
+			CPUs:      24,
+			MemoryMiB: 174080,
+			GPUs:      2,
+			GPUType:   "nvidia-tesla-a100",
+		}))
+	})
+
+	It("should convert machine types into DRMAA2 machines", func() {
+		machines := MachineTypesToMachines(MachineTypes(), nil)
+		Expect(len(machines)).To(Equal(len(MachineTypes())))
+		Expect(machines[0].Name < machines[1].Name).To(BeTrue())
+
+		machines = MachineTypesToMachines(MachineTypes(),
+			[]string{"t2a-standard-4", "g2-standard-8", "unknown"})
+		Expect(machines).To(HaveLen(2))
+
+		Expect(machines[0].Name).To(Equal("g2-standard-8"))
+		Expect(machines[0].CoresPerSocket).To(Equal(int64(8)))
+		Expect(machines[0].PhysicalMemory).To(Equal(int64(32 * 1024 * 1024)))
+		Expect(machines[0].Architecture).To(Equal(drmaa2interface.X64))
+		Expect(machines[0].OS).To(Equal(drmaa2interface.Linux))
+		Expect(machines[0].ExtensionList).To(HaveKeyWithValue(ExtensionAccelerators, "1*nvidia-l4"))
+
+		Expect(machines[1].Name).To(Equal("t2a-standard-4"))
+		Expect(machines[1].Architecture).To(Equal(drmaa2interface.ARM64))
+		Expect(machines[1].ExtensionList).NotTo(HaveKey(ExtensionAccelerators))
+	})
+
+})
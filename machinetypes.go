@@ -0,0 +1,182 @@
+package gcpbatchtracker
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dgruber/drmaa2interface"
+)
+
+// machineTypesCSV is the catalog of Compute Engine machine types with
+// the amount of vCPUs, memory, and built-in GPUs.
+//
+//go:embed machinetypes.csv
+var machineTypesCSV string
+
+// MachineType describes the capacity of a Compute Engine machine type.
+type MachineType struct {
+	Name      string
+	CPUs      int64
+	MemoryMiB int64
+	// GPUs is the amount of built-in GPUs (like for a2-highgpu-1g)
+	GPUs    int64
+	GPUType string
+}
+
+// memoryReservePercent is the share of the machine memory which is
+// not used for the default memory of tasks as it is required by the
+// OS and the Batch agent.
+const memoryReservePercent = 10
+
+// custom machine types like "custom-4-8192", "n2-custom-8-65536-ext"
+var customMachineType = regexp.MustCompile(`^(?:([a-z0-9]+)-)?custom-([0-9]+)-([0-9]+)(-ext)?$`)
+
+var machineTypes = parseMachineTypes(machineTypesCSV)
+
+func parseMachineTypes(catalog string) map[string]MachineType {
+	r := csv.NewReader(strings.NewReader(catalog))
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("invalid machine type catalog: %v", err))
+	}
+	types := make(map[string]MachineType, len(records))
+	for _, record := range records {
+		m := MachineType{Name: record[0], GPUType: record[4]}
+		for i, value := range []*int64{&m.CPUs, &m.MemoryMiB, &m.GPUs} {
+			if *value, err = strconv.ParseInt(record[i+1], 10, 64); err != nil {
+				panic(fmt.Sprintf("invalid machine type catalog entry %v: %v", record, err))
+			}
+		}
+		types[m.Name] = m
+	}
+	return types
+}
+
+// GetMachineType returns the capacity of the machine type. Custom
+// machine types ("custom-<vCPUs>-<memory MiB>") are parsed. Instance
+// templates and unknown machine types return false.
+func GetMachineType(machine string) (MachineType, bool) {
+	if m, exists := machineTypes[machine]; exists {
+		return m, true
+	}
+	if match := customMachineType.FindStringSubmatch(machine); match != nil {
+		cpus, err := strconv.ParseInt(match[2], 10, 64)
+		if err != nil {
+			return MachineType{}, false
+		}
+		memory, err := strconv.ParseInt(match[3], 10, 64)
+		if err != nil {
+			return MachineType{}, false
+		}
+		return MachineType{Name: machine, CPUs: cpus, MemoryMiB: memory}, true
+	}
+	return MachineType{}, false
+}
+
+// MachineTypes returns all machine types of the catalog.
+func MachineTypes() []MachineType {
+	types := make([]MachineType, 0, len(machineTypes))
+	for _, m := range machineTypes {
+		types = append(types, m)
+	}
+	return types
+}
+
+// DefaultTaskCPUMilli returns the CPU milli cores of a task when
+// tasksPerNode tasks are running on the machine at the same time.
+func DefaultTaskCPUMilli(machine string, tasksPerNode int64) int64 {
+	if tasksPerNode < 1 {
+		tasksPerNode = 1
+	}
+	return DefaultCPUMilli(machine) / tasksPerNode
+}
+
+// DefaultTaskMemoryMiB returns the memory of a task when tasksPerNode
+// tasks are running on the machine at the same time. For unknown machine
+// types 0 is returned so that the Google Batch default is used.
+func DefaultTaskMemoryMiB(machine string, tasksPerNode int64) int64 {
+	m, known := GetMachineType(machine)
+	if !known {
+		return 0
+	}
+	if tasksPerNode < 1 {
+		tasksPerNode = 1
+	}
+	return m.MemoryMiB * (100 - memoryReservePercent) / 100 / tasksPerNode
+}
+
+// TasksPerNode returns how many tasks requiring the given CPU milli
+// cores and memory fit on the machine. 0 is returned if the machine
+// type is unknown or no requirements are given.
+func TasksPerNode(machine string, cpuMilli, memoryMiB int64) int64 {
+	m, known := GetMachineType(machine)
+	if !known || (cpuMilli <= 0 && memoryMiB <= 0) {
+		return 0
+	}
+	tasks := int64(-1)
+	if cpuMilli > 0 {
+		tasks = m.CPUs * 1000 / cpuMilli
+	}
+	if memoryMiB > 0 {
+		if memoryTasks := m.MemoryMiB / memoryMiB; tasks < 0 || memoryTasks < tasks {
+			tasks = memoryTasks
+		}
+	}
+	return tasks
+}
+
+// validateMachineCapacity checks that the requested memory of a task
+// fits on the machine type and that the requested CPU milli cores and
+// memory of all tasks fit when multiple tasks run on a machine. The CPU
+// milli cores of a single task are not limited.
+func validateMachineCapacity(machine string, cpuMilli, memoryMiB, tasksPerNode int64) error {
+	m, known := GetMachineType(machine)
+	if !known {
+		return nil
+	}
+	if tasksPerNode < 1 {
+		tasksPerNode = 1
+	}
+	if tasksPerNode > 1 && cpuMilli*tasksPerNode > m.CPUs*1000 {
+		return fmt.Errorf("%d tasks with %d milli cores exceed the %d vCPUs of machine type %s",
+			tasksPerNode, cpuMilli, m.CPUs, machine)
+	}
+	if memoryMiB*tasksPerNode > m.MemoryMiB {
+		return fmt.Errorf("%d tasks with %d MiB memory exceed the %d MiB of machine type %s",
+			tasksPerNode, memoryMiB, m.MemoryMiB, machine)
+	}
+	return nil
+}
+
+// autoTasksPerNode returns the amount of tasks per node derived from
+// the task resources or 0 if only one task fits on the machine.
+func autoTasksPerNode(machine string, cpuMilli, memoryMiB int64) int64 {
+	if tasks := TasksPerNode(machine, cpuMilli, memoryMiB); tasks > 1 {
+		return tasks
+	}
+	return 0
+}
+
+// taskResources returns the CPU milli cores and the memory which are
+// requested by the job template (0 if not set or invalid) and the tasks
+// per node.
+func taskResources(jt drmaa2interface.JobTemplate) (int64, int64, int64) {
+	var cpuMilli int64
+	if limit, exists := jt.ResourceLimits[ResourceLimitCPUMilli]; exists {
+		cpuMilli, _ = strconv.ParseInt(limit, 10, 64)
+	}
+	machine := ""
+	if len(jt.CandidateMachines) > 0 {
+		machine = jt.CandidateMachines[0]
+	}
+	tasksPerNode, exists := GetTasksPerNodeExtension(jt)
+	if !exists {
+		tasksPerNode = autoTasksPerNode(machine, cpuMilli, jt.MinPhysMemory)
+	}
+	return cpuMilli, jt.MinPhysMemory, tasksPerNode
+}
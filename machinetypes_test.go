@@ -0,0 +1,87 @@
+package gcpbatchtracker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Machinetypes", func() {
+
+	It("should return the capacity of machine types", func() {
+		m, exists := GetMachineType("e2-medium")
+		Expect(exists).To(BeTrue())
+		Expect(m.CPUs).To(Equal(int64(2)))
+		Expect(m.MemoryMiB).To(Equal(int64(4096)))
+
+		m, exists = GetMachineType("a2-highgpu-2g")
+		Expect(exists).To(BeTrue())
+		Expect(m.GPUs).To(Equal(int64(2)))
+		Expect(m.GPUType).To(Equal("nvidia-tesla-a100"))
+
+		m, exists = GetMachineType("n2-custom-8-65536-ext")
+		Expect(exists).To(BeTrue())
+		Expect(m.CPUs).To(Equal(int64(8)))
+		Expect(m.MemoryMiB).To(Equal(int64(65536)))
+
+		_, exists = GetMachineType("template:my-template")
+		Expect(exists).To(BeFalse())
+		Expect(len(MachineTypes())).To(BeNumerically(">", 100))
+	})
+
+	It("should derive the default CPU and memory of a task", func() {
+		Expect(DefaultCPUMilli("f1-micro")).To(Equal(int64(1000)))
+		Expect(DefaultCPUMilli("custom-4-8192")).To(Equal(int64(4000)))
+		Expect(DefaultCPUMilli("unknown-16")).To(Equal(int64(16000)))
+		Expect(DefaultTaskCPUMilli("n2-standard-8", 4)).To(Equal(int64(2000)))
+		Expect(DefaultTaskMemoryMiB("n2-standard-8", 1)).To(Equal(int64(29491)))
+		Expect(DefaultTaskMemoryMiB("n2-standard-8", 2)).To(Equal(int64(14745)))
+		Expect(DefaultTaskMemoryMiB("template:my-template", 1)).To(Equal(int64(0)))
+		Expect(TasksPerNode("n2-standard-8", 2000, 0)).To(Equal(int64(4)))
+		Expect(TasksPerNode("n2-standard-8", 2000, 16384)).To(Equal(int64(2)))
+		Expect(TasksPerNode("unknown", 2000, 0)).To(Equal(int64(0)))
+	})
+
+	It("should set the task resources and tasks per node", func() {
+		jt := drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			MaxSlots:          8,
+			CandidateMachines: []string{"n2-standard-8"},
+		}
+		req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.CpuMilli).To(Equal(int64(8000)))
+		Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.MemoryMib).To(Equal(int64(0)))
+		Expect(req.Job.TaskGroups[0].TaskCountPerNode).To(Equal(int64(0)))
+
+		jt.ResourceLimits = map[string]string{ResourceLimitCPUMilli: "2000"}
+		req, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.CpuMilli).To(Equal(int64(2000)))
+		Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.MemoryMib).To(Equal(int64(7372)))
+		Expect(req.Job.TaskGroups[0].TaskCountPerNode).To(Equal(int64(4)))
+
+		jt = SetTasksPerNodeExtension(jt, 2)
+		req, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.TaskGroups[0].TaskCountPerNode).To(Equal(int64(2)))
+	})
+
+	It("should reject requests exceeding the machine capacity", func() {
+		jt := drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+			MinPhysMemory:     32768,
+		}
+		_, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(HaveOccurred())
+
+		jt.MinPhysMemory = 4096
+		jt = SetTasksPerNodeExtension(jt, 8)
+		_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(HaveOccurred())
+	})
+
+})
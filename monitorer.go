@@ -1,11 +1,6 @@
 package gcpbatchtracker
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
-
-	"cloud.google.com/go/batch/apiv1/batchpb"
 	"github.com/dgruber/drmaa2interface"
 )
 
@@ -16,19 +11,31 @@ func (t *GCPBatchTracker) OpenMonitoringSession(name string) error {
 	return nil
 }
 
+// GetAllJobIDs returns the IDs of all jobs in the location of the tracker
+// (independent of the job session) which match the filter. A nil filter
+// returns all jobs; unset fields (see drmaa2interface.CreateJobInfo())
+// don't filter. The state, submission time, ID, Annotation, QueueName,
+// and JobOwner are filtered by Google Batch (see BatchJobFilter()).
 func (t *GCPBatchTracker) GetAllJobIDs(filter *drmaa2interface.JobInfo) ([]string, error) {
 	// don't filter for session names
-	return listJobs(t, false)
+	return listJobs(t, false, filter)
 }
 
+// GetAllQueueNames returns the names of the queues defined on the
+// tracker (see SetQueues()). Google Batch itself has no queues. If the
+// filter is not empty only the queues with the given names are returned.
 func (t *GCPBatchTracker) GetAllQueueNames(filter []string) ([]string, error) {
-	// no queues in Google Batch
-	return []string{}, nil
+	return t.queueNames(filter), nil
 }
 
+// GetAllMachines returns the machine types which are available in the
+// location of the tracker. If the filter is not empty only the machine
+// types with the given names are returned. The machine types are
+// requested from the Compute Engine API and cached for an hour. If the
+// Compute Engine API fails the machine types of the embedded catalog
+// are returned (see MachineTypes()).
 func (t *GCPBatchTracker) GetAllMachines(filter []string) ([]drmaa2interface.Machine, error) {
-	// TODO: get machine types from Google Cloud API
-	return nil, fmt.Errorf("not yet implemented")
+	return MachineTypesToMachines(t.machineTypesOrCatalog(filter), filter), nil
 }
 
 func (t *GCPBatchTracker) CloseMonitoringSession(name string) error {
@@ -38,20 +45,8 @@ func (t *GCPBatchTracker) CloseMonitoringSession(name string) error {
 // JobInfoFromMonitor might collect job state and job info in a
 // different way as a JobSession with persistent storage does
 func (t *GCPBatchTracker) JobInfoFromMonitor(jobID string) (drmaa2interface.JobInfo, error) {
-
 	// cached by ListJobs()
-	if ji, found := t.jcache.Get(jobID); found {
-		var jobInfo drmaa2interface.JobInfo
-		if err := json.Unmarshal(ji.([]byte), &jobInfo); err != nil {
-			fmt.Printf("could not unmarshal job info: %v", err)
-			return drmaa2interface.JobInfo{}, err
-		}
-		return jobInfo, nil
-	}
-
-	job, err := t.client.GetJob(context.Background(), &batchpb.GetJobRequest{
-		Name: jobID,
-	})
+	job, err := t.getJob(jobID)
 	if err != nil {
 		return drmaa2interface.JobInfo{}, err
 	}
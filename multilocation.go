@@ -0,0 +1,406 @@
+package gcpbatchtracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	batch "cloud.google.com/go/batch/apiv1"
+	"github.com/dgruber/drmaa2interface"
+	"github.com/dgruber/drmaa2os/pkg/helper"
+)
+
+// MultiLocationTracker implements the JobTracker interface for jobs
+// in multiple locations (regions) of a project. It uses one
+// GCPBatchTracker per location. New jobs are submitted to the location
+// of the "location" extension of the job template or, if not set, to the
+// location selected by the LocationPolicy. All other job operations are
+// sent to the location which is part of the job ID
+// ("projects/<project>/locations/<location>/jobs/<job>").
+type MultiLocationTracker struct {
+	// locations in the order of preference
+	locations []string
+	trackers  map[string]*GCPBatchTracker
+	policy    LocationPolicy
+}
+
+// LocationPolicy selects the location in which a new job is submitted.
+type LocationPolicy interface {
+	SelectLocation(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error)
+}
+
+// LocationPolicyFunc is a function which implements the LocationPolicy
+// interface.
+type LocationPolicyFunc func(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error)
+
+func (f LocationPolicyFunc) SelectLocation(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error) {
+	return f(m, jt)
+}
+
+// NewMultiLocationTracker returns a tracker for jobs in the given
+// locations (like "us-central1", "europe-west4") of the project. The
+// first location is used for new jobs until a different LocationPolicy
+// is set.
+func NewMultiLocationTracker(drmaa2session, project string, locations []string) (*MultiLocationTracker, error) {
+	client, err := batch.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	trackers := make(map[string]*GCPBatchTracker, len(locations))
+	for _, location := range locations {
+		trackers[location] = newGCPBatchTracker(client, drmaa2session, project, location)
+	}
+	return newMultiLocationTracker(locations, trackers)
+}
+
+// NewMultiLocationTrackerFromTrackers returns a tracker which uses the
+// given trackers (like with different queues or job template storage
+// settings). The map key is the location of the tracker. The locations
+// are in alphabetical order.
+func NewMultiLocationTrackerFromTrackers(trackers map[string]*GCPBatchTracker) (*MultiLocationTracker, error) {
+	locations := make([]string, 0, len(trackers))
+	for location, tracker := range trackers {
+		if tracker.location != "" && tracker.location != location {
+			return nil, fmt.Errorf("tracker for location %s is in location %s",
+				location, tracker.location)
+		}
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	return newMultiLocationTracker(locations, trackers)
+}
+
+func newMultiLocationTracker(locations []string, trackers map[string]*GCPBatchTracker) (*MultiLocationTracker, error) {
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("at least one location is required")
+	}
+	if len(trackers) != len(locations) {
+		return nil, fmt.Errorf("locations must be unique: %v", locations)
+	}
+	return &MultiLocationTracker{
+		locations: locations,
+		trackers:  trackers,
+		policy:    FirstLocationPolicy,
+	}, nil
+}
+
+// SetLocationPolicy sets the policy which selects the location of new
+// jobs which don't have the "location" extension set.
+func (m *MultiLocationTracker) SetLocationPolicy(policy LocationPolicy) {
+	m.policy = policy
+}
+
+// Locations returns the locations of the tracker.
+func (m *MultiLocationTracker) Locations() []string {
+	return append([]string{}, m.locations...)
+}
+
+// Tracker returns the tracker of the location (like for settings which
+// are specific to the location).
+func (m *MultiLocationTracker) Tracker(location string) (*GCPBatchTracker, bool) {
+	tracker, exists := m.trackers[location]
+	return tracker, exists
+}
+
+// LocationFromJobID returns the location of a job ID
+// ("projects/<project>/locations/<location>/jobs/<job>").
+func LocationFromJobID(jobID string) (string, error) {
+	parts := strings.Split(jobID, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" ||
+		parts[4] != "jobs" || parts[3] == "" {
+		return "", fmt.Errorf("job ID %s is not a full job name (projects/<project>/locations/<location>/jobs/<job>)",
+			jobID)
+	}
+	return parts[3], nil
+}
+
+// jobTracker returns the tracker of the location of the job.
+func (m *MultiLocationTracker) jobTracker(jobID string) (*GCPBatchTracker, error) {
+	location, err := LocationFromJobID(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJobNotFound, err)
+	}
+	tracker, exists := m.trackers[location]
+	if !exists {
+		return nil, fmt.Errorf("%w: location %s of job %s is not managed by the tracker",
+			ErrJobNotFound, location, jobID)
+	}
+	return tracker, nil
+}
+
+// selectTracker returns the tracker of the location in which the job
+// is submitted.
+func (m *MultiLocationTracker) selectTracker(jt drmaa2interface.JobTemplate) (*GCPBatchTracker, error) {
+	location, exists := GetLocationExtension(jt)
+	if !exists {
+		var err error
+		if location, err = m.policy.SelectLocation(m, jt); err != nil {
+			return nil, fmt.Errorf("could not select location: %v", err)
+		}
+	}
+	tracker, exists := m.trackers[location]
+	if !exists {
+		return nil, fmt.Errorf("location %s is not managed by the tracker", location)
+	}
+	return tracker, nil
+}
+
+// FirstLocationPolicy selects the first location of the tracker.
+var FirstLocationPolicy = LocationPolicyFunc(
+	func(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error) {
+		return m.locations[0], nil
+	})
+
+// ExplicitLocationPolicy requires that the location of each job is set
+// with the "location" extension (see SetLocationExtension()).
+var ExplicitLocationPolicy = LocationPolicyFunc(
+	func(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error) {
+		return "", fmt.Errorf("job template has no %s extension", ExtensionLocation)
+	})
+
+// CheapestLocationPolicy selects the location with the lowest price
+// for the job. Price returns the price of the job in a location and
+// false if it is unknown. If Price is nil the estimated cost of the job
+// running for one hour is used (see EstimateCost()). Locations with
+// unknown prices are only selected if no price is known.
+type CheapestLocationPolicy struct {
+	Price func(location string, jt drmaa2interface.JobTemplate) (float64, bool)
+}
+
+func (p CheapestLocationPolicy) SelectLocation(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error) {
+	price := p.Price
+	if price == nil {
+		price = func(location string, jt drmaa2interface.JobTemplate) (float64, bool) {
+			req, _, err := m.trackers[location].PlanJob(jt)
+			if err != nil {
+				return 0, false
+			}
+			cost, err := GetPriceTable().JobCost(location, req.Job, time.Hour)
+			return cost.Total, err == nil
+		}
+	}
+	cheapest := m.locations[0]
+	lowest := -1.0
+	for _, location := range m.locations {
+		if p, known := price(location, jt); known && (lowest < 0 || p < lowest) {
+			cheapest, lowest = location, p
+		}
+	}
+	return cheapest, nil
+}
+
+// LeastQueuedLocationPolicy selects the location with the least queued
+// jobs of the job session. Locations in which the jobs can't be listed
+// are skipped.
+var LeastQueuedLocationPolicy = LocationPolicyFunc(
+	func(m *MultiLocationTracker, jt drmaa2interface.JobTemplate) (string, error) {
+		filter := drmaa2interface.CreateJobInfo()
+		filter.State = drmaa2interface.Queued
+		selected := ""
+		least := 0
+		var lastErr error
+		for _, location := range m.locations {
+			queued, err := listJobs(m.trackers[location], true, &filter)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if selected == "" || len(queued) < least {
+				selected, least = location, len(queued)
+			}
+		}
+		if selected == "" {
+			return "", fmt.Errorf("could not list queued jobs: %v", lastErr)
+		}
+		return selected, nil
+	})
+
+// ListJobs returns the visible job IDs of all locations.
+func (m *MultiLocationTracker) ListJobs() ([]string, error) {
+	var jobs []string
+	for _, location := range m.locations {
+		locationJobs, err := m.trackers[location].ListJobs()
+		if err != nil {
+			return nil, fmt.Errorf("could not list jobs in %s: %v", location, err)
+		}
+		jobs = append(jobs, locationJobs...)
+	}
+	return jobs, nil
+}
+
+// ListArrayJobs returns all job IDs an job array ID (or array job ID)
+// represents or an error.
+func (m *MultiLocationTracker) ListArrayJobs(arrayjobID string) ([]string, error) {
+	return helper.ArrayJobID2GUIDs(arrayjobID)
+}
+
+// AddJob submits the job in the location of the "location" extension
+// or in the location selected by the LocationPolicy.
+func (m *MultiLocationTracker) AddJob(jt drmaa2interface.JobTemplate) (string, error) {
+	tracker, err := m.selectTracker(jt)
+	if err != nil {
+		return "", err
+	}
+	return tracker.AddJob(jt)
+}
+
+// AddArrayJob submits all jobs of the job array in the same location.
+func (m *MultiLocationTracker) AddArrayJob(jt drmaa2interface.JobTemplate, begin int, end int, step int, maxParallel int) (string, error) {
+	tracker, err := m.selectTracker(jt)
+	if err != nil {
+		return "", err
+	}
+	return tracker.AddArrayJob(jt, begin, end, step, maxParallel)
+}
+
+func (m *MultiLocationTracker) JobState(jobID string) (drmaa2interface.JobState, string, error) {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return drmaa2interface.Undetermined, "", err
+	}
+	return tracker.JobState(jobID)
+}
+
+func (m *MultiLocationTracker) JobInfo(jobID string) (drmaa2interface.JobInfo, error) {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return drmaa2interface.JobInfo{}, err
+	}
+	return tracker.JobInfo(jobID)
+}
+
+// JobInfos returns the job infos of the jobs of all locations (see
+// GCPBatchTracker.JobInfos()).
+func (m *MultiLocationTracker) JobInfos(ids []string) (map[string]drmaa2interface.JobInfo, error) {
+	jobInfos := make(map[string]drmaa2interface.JobInfo, len(ids))
+	errs := make(map[string]error)
+	locationJobs := make(map[*GCPBatchTracker][]string)
+	for _, jobID := range ids {
+		tracker, err := m.jobTracker(jobID)
+		if err != nil {
+			errs[jobID] = err
+			continue
+		}
+		locationJobs[tracker] = append(locationJobs[tracker], jobID)
+	}
+	for tracker, jobIDs := range locationJobs {
+		locationJobInfos, err := tracker.JobInfos(jobIDs)
+		for jobID, ji := range locationJobInfos {
+			jobInfos[jobID] = ji
+		}
+		var jobInfosErr *JobInfosError
+		if errors.As(err, &jobInfosErr) {
+			for jobID, jobErr := range jobInfosErr.Errors {
+				errs[jobID] = jobErr
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return jobInfos, &JobInfosError{Errors: errs}
+	}
+	return jobInfos, nil
+}
+
+func (m *MultiLocationTracker) JobControl(jobID string, action string) error {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return err
+	}
+	return tracker.JobControl(jobID, action)
+}
+
+func (m *MultiLocationTracker) Wait(jobID string, timeout time.Duration, state ...drmaa2interface.JobState) error {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return err
+	}
+	return tracker.Wait(jobID, timeout, state...)
+}
+
+func (m *MultiLocationTracker) DeleteJob(jobID string) error {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return err
+	}
+	return tracker.DeleteJob(jobID)
+}
+
+func (m *MultiLocationTracker) ListJobCategories() ([]string, error) {
+	return m.trackers[m.locations[0]].ListJobCategories()
+}
+
+// JobTemplate implements the JobTemplater interface.
+func (m *MultiLocationTracker) JobTemplate(jobID string) (drmaa2interface.JobTemplate, error) {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return drmaa2interface.JobTemplate{}, err
+	}
+	return tracker.JobTemplate(jobID)
+}
+
+// All methods required for the DRMAA2 MonitoringSession
+
+func (m *MultiLocationTracker) OpenMonitoringSession(name string) error {
+	return nil
+}
+
+// GetAllJobIDs returns the IDs of the jobs of all locations which
+// match the filter (see GCPBatchTracker.GetAllJobIDs()).
+func (m *MultiLocationTracker) GetAllJobIDs(filter *drmaa2interface.JobInfo) ([]string, error) {
+	var jobs []string
+	for _, location := range m.locations {
+		locationJobs, err := m.trackers[location].GetAllJobIDs(filter)
+		if err != nil {
+			return nil, fmt.Errorf("could not list jobs in %s: %v", location, err)
+		}
+		jobs = append(jobs, locationJobs...)
+	}
+	return jobs, nil
+}
+
+// GetAllQueueNames returns the sorted names of the queues of all
+// locations.
+func (m *MultiLocationTracker) GetAllQueueNames(filter []string) ([]string, error) {
+	var names []string
+	for _, tracker := range m.trackers {
+		for _, name := range tracker.queueNames(filter) {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetAllMachines returns the machine types which are available in any
+// of the locations. Locations for which the Compute Engine API fails
+// contribute the machine types of the embedded catalog.
+func (m *MultiLocationTracker) GetAllMachines(filter []string) ([]drmaa2interface.Machine, error) {
+	types := make(map[string]MachineType)
+	for _, location := range m.locations {
+		for _, machineType := range m.trackers[location].machineTypesOrCatalog(filter) {
+			types[machineType.Name] = machineType
+		}
+	}
+	machineTypes := make([]MachineType, 0, len(types))
+	for _, machineType := range types {
+		machineTypes = append(machineTypes, machineType)
+	}
+	return MachineTypesToMachines(machineTypes, filter), nil
+}
+
+func (m *MultiLocationTracker) CloseMonitoringSession(name string) error {
+	return nil
+}
+
+func (m *MultiLocationTracker) JobInfoFromMonitor(jobID string) (drmaa2interface.JobInfo, error) {
+	tracker, err := m.jobTracker(jobID)
+	if err != nil {
+		return drmaa2interface.JobInfo{}, err
+	}
+	return tracker.JobInfoFromMonitor(jobID)
+}
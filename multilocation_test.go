@@ -0,0 +1,87 @@
+package gcpbatchtracker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Multi location tracker", func() {
+
+	var (
+		tracker *MultiLocationTracker
+		jt      drmaa2interface.JobTemplate
+	)
+
+	BeforeEach(func() {
+		us := &GCPBatchTracker{}
+		Expect(us.SetQueues([]Queue{{Name: "default"}, {Name: "gpu"}})).To(Succeed())
+		eu := &GCPBatchTracker{}
+		Expect(eu.SetQueues([]Queue{{Name: "default"}, {Name: "highmem"}})).To(Succeed())
+		var err error
+		tracker, err = NewMultiLocationTrackerFromTrackers(map[string]*GCPBatchTracker{
+			"us-central1":  us,
+			"europe-west4": eu,
+		})
+		Expect(err).To(BeNil())
+		jt = drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+	})
+
+	It("should decode the location from the job ID", func() {
+		location, err := LocationFromJobID("projects/p/locations/europe-west4/jobs/job1")
+		Expect(err).To(BeNil())
+		Expect(location).To(Equal("europe-west4"))
+		_, err = LocationFromJobID("job1")
+		Expect(err).To(HaveOccurred())
+		_, err = LocationFromJobID("projects/p/locations//jobs/job1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject jobs in locations which are not managed", func() {
+		Expect(tracker.Locations()).To(Equal([]string{"europe-west4", "us-central1"}))
+		_, _, err := tracker.JobState("projects/p/locations/asia-east1/jobs/job1")
+		Expect(err).To(HaveOccurred())
+		_, err = tracker.JobInfo("job1")
+		Expect(err).To(HaveOccurred())
+		_, err = tracker.AddJob(SetLocationExtension(jt, "asia-east1"))
+		Expect(err).To(HaveOccurred())
+		_, err = NewMultiLocationTrackerFromTrackers(nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should select the location by the policy", func() {
+		location, err := FirstLocationPolicy.SelectLocation(tracker, jt)
+		Expect(err).To(BeNil())
+		Expect(location).To(Equal("europe-west4"))
+
+		_, err = ExplicitLocationPolicy.SelectLocation(tracker, jt)
+		Expect(err).To(HaveOccurred())
+		tracker.SetLocationPolicy(ExplicitLocationPolicy)
+		_, err = tracker.AddJob(jt)
+		Expect(err).To(HaveOccurred())
+
+		location, err = CheapestLocationPolicy{}.SelectLocation(tracker, jt)
+		Expect(err).To(BeNil())
+		Expect(location).To(Equal("us-central1"))
+
+		location, err = CheapestLocationPolicy{
+			Price: func(location string, jt drmaa2interface.JobTemplate) (float64, bool) {
+				return 1.0, location == "europe-west4"
+			},
+		}.SelectLocation(tracker, jt)
+		Expect(err).To(BeNil())
+		Expect(location).To(Equal("europe-west4"))
+	})
+
+	It("should return the queues of all locations", func() {
+		names, err := tracker.GetAllQueueNames(nil)
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"default", "gpu", "highmem"}))
+	})
+
+})
@@ -0,0 +1,161 @@
+package gcpbatchtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
+)
+
+// Warning describes an input of a job template which is silently
+// ignored when the job template is converted into a Google Batch job.
+type Warning struct {
+	// Field is the job template field (like "ResourceLimits[runtime]")
+	Field string
+	// Message describes why the input is ignored
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Field, w.Message)
+}
+
+// knownExtensions are all job template extensions which are evaluated
+// when converting a job template.
+var knownExtensions = map[string]bool{
+	ExtensionProlog:                        true,
+	ExtensionEpilog:                        true,
+	ExtensionSpot:                          true,
+	ExtensionAccelerators:                  true,
+	ExtensionTasksPerNode:                  true,
+	ExtensionDockerOptions:                 true,
+	ExtensionGoogleSecretEnv:               true,
+	ExtensionBootDiskImage:                 true,
+	ExtensionBootDiskType:                  true,
+	ExtensionBootDiskSizeGB:                true,
+	ExtensionReservation:                   true,
+	ExtensionPlacementCollocation:          true,
+	ExtensionPlacementMaxDistance:          true,
+	ExtensionMaxRetryCount:                 true,
+	ExtensionRetryExitCodes:                true,
+	ExtensionFailExitCodes:                 true,
+	ExtensionContainerRegistryCredentials:  true,
+	ExtensionContainerImageStreaming:       true,
+	ExtensionContainerBlockExternalNetwork: true,
+	ExtensionContainerSecurityProfile:      true,
+	ExtensionRunnables:                     true,
+	ExtensionStrictValidation:              true,
+	ExtensionLabels:                        true,
+	ExtensionNetwork:                       true,
+	ExtensionSubnetwork:                    true,
+	ExtensionServiceAccount:                true,
+	ExtensionAllowedLocations:              true,
+	ExtensionLocation:                      true,
+	ExtensionJobOwner:                      true,
+}
+
+// PlanJob validates and converts the job template into the Google Batch
+// job request which AddJob() would submit, without submitting it and
+// without creating any stage out buckets. The returned warnings list
+// inputs of the job template which are ignored by the conversion.
+func (t *GCPBatchTracker) PlanJob(jt drmaa2interface.JobTemplate) (*batchpb.CreateJobRequest, []Warning, error) {
+	jt, err := t.prepareJobTemplate(jt)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings := JobTemplateWarnings(jt)
+	req, err := ConvertJobTemplateToJobRequest(t.drmaa2session, t.project, t.location, jt)
+	if err != nil {
+		return nil, warnings, err
+	}
+	// only the compressed job template storage has no side effects
+	if t.jobTemplateStorage == JobTemplateStorageCompressedEnv {
+		if _, err := t.storeJobTemplates(req); err != nil {
+			return nil, warnings, err
+		}
+	}
+	return req, warnings, nil
+}
+
+// JobTemplateWarnings returns the inputs of the job template which
+// are ignored when converting it into a Google Batch job: additional
+// CandidateMachines, resource limits which can't be parsed, and unknown
+// extensions.
+func JobTemplateWarnings(jt drmaa2interface.JobTemplate) []Warning {
+	warnings := []Warning{}
+	for i, machine := range jt.CandidateMachines {
+		if i == 0 {
+			continue
+		}
+		warnings = append(warnings, Warning{
+			Field:   "CandidateMachines",
+			Message: fmt.Sprintf("only the first machine type is used, %s is ignored", machine),
+		})
+	}
+	for _, limit := range sortedKeys(jt.ResourceLimits) {
+		value := jt.ResourceLimits[limit]
+		var err error
+		switch limit {
+		case ResourceLimitRuntime:
+			_, err = time.ParseDuration(value)
+		case ResourceLimitBootDisk, ResourceLimitCPUMilli:
+			_, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown resource limit")
+		}
+		if err != nil {
+			warnings = append(warnings, Warning{
+				Field:   fmt.Sprintf("ResourceLimits[%s]", limit),
+				Message: fmt.Sprintf("%s is ignored (%v)", value, err),
+			})
+		}
+	}
+	for _, extension := range sortedKeys(jt.ExtensionList) {
+		if !knownExtensions[extension] {
+			warnings = append(warnings, Warning{
+				Field:   fmt.Sprintf("ExtensionList[%s]", extension),
+				Message: "unknown extension is ignored",
+			})
+		}
+	}
+	return warnings
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// JobConfigJSON renders the job of the job request as JSON which can
+// be submitted with "gcloud batch jobs submit --config".
+func JobConfigJSON(req *batchpb.CreateJobRequest) ([]byte, error) {
+	config, err := protojson.MarshalOptions{Multiline: true}.Marshal(req.GetJob())
+	if err != nil {
+		return nil, fmt.Errorf("could not render job as JSON: %v", err)
+	}
+	return config, nil
+}
+
+// JobConfigYAML renders the job of the job request as YAML which can
+// be submitted with "gcloud batch jobs submit --config".
+func JobConfigYAML(req *batchpb.CreateJobRequest) ([]byte, error) {
+	config, err := protojson.Marshal(req.GetJob())
+	if err != nil {
+		return nil, fmt.Errorf("could not render job as YAML: %v", err)
+	}
+	var job map[string]interface{}
+	if err := json.Unmarshal(config, &job); err != nil {
+		return nil, fmt.Errorf("could not render job as YAML: %v", err)
+	}
+	return yaml.Marshal(job)
+}
@@ -0,0 +1,85 @@
+package gcpbatchtracker_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Plan", func() {
+
+	jt := drmaa2interface.JobTemplate{
+		JobName:           "plan",
+		RemoteCommand:     "/bin/sh",
+		Args:              []string{"-c", "echo hello"},
+		JobCategory:       "busybox",
+		MinSlots:          1,
+		MaxSlots:          1,
+		CandidateMachines: []string{"e2-standard-4", "n2-standard-4"},
+		ResourceLimits: map[string]string{
+			ResourceLimitRuntime:  "1 hour",
+			ResourceLimitCPUMilli: "2000",
+		},
+		StageOutFiles: map[string]string{
+			"/output": "gs://notcreatedbucket",
+		},
+	}
+	jt.ExtensionList = map[string]string{
+		"sopt": "true",
+	}
+
+	It("should plan a job without submitting it", func() {
+		tracker := &GCPBatchTracker{}
+		req, warnings, err := tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.TaskGroups[0].TaskSpec.ComputeResource.CpuMilli).To(Equal(int64(2000)))
+		Expect(req.Job.TaskGroups[0].TaskSpec.MaxRunDuration).To(BeNil())
+		Expect(warnings).To(HaveLen(3))
+		Expect(warnings[0].Field).To(Equal("CandidateMachines"))
+		Expect(warnings[1].Field).To(Equal("ResourceLimits[runtime]"))
+		Expect(warnings[2].Field).To(Equal("ExtensionList[sopt]"))
+		Expect(warnings[2].String()).To(ContainSubstring("unknown extension"))
+
+		_, warnings, err = tracker.PlanJob(drmaa2interface.JobTemplate{})
+		Expect(err).To(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should reject jobs for another location than the location of the tracker", func() {
+		tracker := &GCPBatchTracker{}
+		_, _, err := tracker.PlanJob(SetLocationExtension(drmaa2interface.JobTemplate{
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+		}, "europe-west4"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("europe-west4"))
+		_, err = tracker.AddJob(SetLocationExtension(jt, "europe-west4"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should render the job as gcloud config", func() {
+		req, err := ConvertJobTemplateToJobRequest("session", "project", "location", jt)
+		Expect(err).To(BeNil())
+
+		config, err := JobConfigJSON(req)
+		Expect(err).To(BeNil())
+		var job map[string]interface{}
+		Expect(json.Unmarshal(config, &job)).To(Succeed())
+		Expect(job).To(HaveKey("taskGroups"))
+		Expect(job).To(HaveKey("allocationPolicy"))
+		Expect(job).To(HaveKey("logsPolicy"))
+
+		config, err = JobConfigYAML(req)
+		Expect(err).To(BeNil())
+		job = nil
+		Expect(yaml.Unmarshal(config, &job)).To(Succeed())
+		Expect(job).To(HaveKey("taskGroups"))
+		Expect(job["labels"]).To(HaveKeyWithValue("drmaa2session", "session"))
+	})
+
+})
@@ -0,0 +1,167 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dgruber/drmaa2interface"
+	"gopkg.in/yaml.v3"
+)
+
+// Google Batch has no queues. Instead operators can define named queues
+// on the tracker. A queue is a preset of job template settings which is
+// merged into job templates which have the queue set as QueueName.
+
+// Queue is a named preset of job template settings.
+type Queue struct {
+	Name string `json:"name" yaml:"name"`
+	// Location is the zone or region in which the VMs are created. It
+	// only sets the allowed locations of the job, the job itself is
+	// always created in the location (region) of the tracker. Hence it
+	// can't move jobs into another region; it must be the region of the
+	// tracker or a zone in that region.
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+	// MachineTypes are the CandidateMachines of the job template
+	MachineTypes   []string `json:"machineTypes,omitempty" yaml:"machineTypes,omitempty"`
+	Spot           bool     `json:"spot,omitempty" yaml:"spot,omitempty"`
+	Network        string   `json:"network,omitempty" yaml:"network,omitempty"`
+	Subnetwork     string   `json:"subnetwork,omitempty" yaml:"subnetwork,omitempty"`
+	ServiceAccount string   `json:"serviceAccount,omitempty" yaml:"serviceAccount,omitempty"`
+	Priority       int64    `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// QueueConfig is the format of the queue config file (YAML or JSON).
+//
+//	queues:
+//	  - name: gpu
+//	    machineTypes: ["g2-standard-8"]
+//	    spot: true
+//	    priority: 10
+type QueueConfig struct {
+	Queues []Queue `json:"queues" yaml:"queues"`
+}
+
+// LoadQueueConfig reads the queues from a YAML or JSON file.
+func LoadQueueConfig(file string) ([]Queue, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read queue config %s: %v", file, err)
+	}
+	var config QueueConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("could not parse queue config %s: %v", file, err)
+	}
+	return config.Queues, nil
+}
+
+// SetQueues defines the queues of the tracker. Existing queues are
+// replaced.
+func (t *GCPBatchTracker) SetQueues(queues []Queue) error {
+	presets := make(map[string]Queue, len(queues))
+	for _, queue := range queues {
+		if queue.Name == "" {
+			return fmt.Errorf("queue name must not be empty")
+		}
+		if _, exists := presets[queue.Name]; exists {
+			return fmt.Errorf("queue %s is defined more than once", queue.Name)
+		}
+		presets[queue.Name] = queue
+	}
+	t.queuesMutex.Lock()
+	defer t.queuesMutex.Unlock()
+	t.queues = presets
+	return nil
+}
+
+// SetQueuesFromFile defines the queues of the tracker from a YAML or
+// JSON file (see QueueConfig).
+func (t *GCPBatchTracker) SetQueuesFromFile(file string) error {
+	queues, err := LoadQueueConfig(file)
+	if err != nil {
+		return err
+	}
+	return t.SetQueues(queues)
+}
+
+// queueNames returns the sorted names of all queues. If the filter is
+// not empty only the queues with the names in the filter are returned.
+func (t *GCPBatchTracker) queueNames(filter []string) []string {
+	t.queuesMutex.RLock()
+	defer t.queuesMutex.RUnlock()
+	names := make([]string, 0, len(t.queues))
+	for name := range t.queues {
+		if len(filter) > 0 && !contains(filter, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applyQueue merges the queue preset of the QueueName of the job
+// template into the job template. Settings of the job template take
+// precedence over the queue preset.
+func (t *GCPBatchTracker) applyQueue(jt drmaa2interface.JobTemplate) (drmaa2interface.JobTemplate, error) {
+	if jt.QueueName == "" {
+		return jt, nil
+	}
+	t.queuesMutex.RLock()
+	queue, exists := t.queues[jt.QueueName]
+	t.queuesMutex.RUnlock()
+	if !exists {
+		return jt, fmt.Errorf("unknown queue: %s", jt.QueueName)
+	}
+	// don't modify the extension list of the caller
+	extensions := make(map[string]string, len(jt.ExtensionList))
+	for k, v := range jt.ExtensionList {
+		extensions[k] = v
+	}
+	jt.ExtensionList = extensions
+
+	if len(jt.CandidateMachines) == 0 {
+		jt.CandidateMachines = queue.MachineTypes
+	}
+	if jt.Priority == 0 {
+		jt.Priority = queue.Priority
+	}
+	if _, exists := GetSpotExtension(jt); !exists && queue.Spot {
+		jt = SetSpotExtension(jt, true)
+	}
+	if _, _, exists := GetNetworkExtension(jt); !exists {
+		jt = SetNetworkExtension(jt, queue.Network, queue.Subnetwork)
+	}
+	if _, exists := GetServiceAccountExtension(jt); !exists && queue.ServiceAccount != "" {
+		jt = SetServiceAccountExtension(jt, queue.ServiceAccount)
+	}
+	if _, exists := GetAllowedLocationsExtension(jt); !exists && queue.Location != "" {
+		jt = SetAllowedLocationsExtension(jt, []string{queue.Location})
+	}
+	return jt, nil
+}
+
+// prepareJobTemplate applies the queue preset and the defaults of the
+// tracker to the job template before it is converted. Job templates for
+// another location than the location of the tracker are rejected.
+func (t *GCPBatchTracker) prepareJobTemplate(jt drmaa2interface.JobTemplate) (drmaa2interface.JobTemplate, error) {
+	if location, exists := GetLocationExtension(jt); exists && location != t.location {
+		return jt, fmt.Errorf("the %s extension %s does not match the location %s of the tracker",
+			ExtensionLocation, location, t.location)
+	}
+	jt, err := t.applyQueue(jt)
+	if err != nil {
+		return jt, err
+	}
+	jt = t.applyJobOwner(t.applyContainerSecurityProfile(jt))
+	return t.applyStrictValidation(jt), nil
+}
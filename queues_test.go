@@ -0,0 +1,94 @@
+package gcpbatchtracker_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Queues", func() {
+
+	config := `queues:
+  - name: gpu
+    location: us-central1-a
+    machineTypes: ["g2-standard-8"]
+    spot: true
+    network: projects/p/global/networks/hpc
+    subnetwork: projects/p/regions/us-central1/subnetworks/hpc
+    serviceAccount: batch@p.iam.gserviceaccount.com
+    priority: 10
+  - name: default
+    machineTypes: ["e2-standard-4"]
+`
+
+	var tracker *GCPBatchTracker
+
+	BeforeEach(func() {
+		file := filepath.Join(GinkgoT().TempDir(), "queues.yaml")
+		Expect(os.WriteFile(file, []byte(config), 0600)).To(Succeed())
+		tracker = &GCPBatchTracker{}
+		Expect(tracker.SetQueuesFromFile(file)).To(Succeed())
+	})
+
+	It("should return the queue names", func() {
+		names, err := tracker.GetAllQueueNames(nil)
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"default", "gpu"}))
+		names, err = tracker.GetAllQueueNames([]string{"gpu", "unknown"})
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([]string{"gpu"}))
+	})
+
+	It("should reject invalid queue definitions", func() {
+		Expect(tracker.SetQueues([]Queue{{Name: ""}})).NotTo(Succeed())
+		Expect(tracker.SetQueues([]Queue{{Name: "a"}, {Name: "a"}})).NotTo(Succeed())
+		Expect(tracker.SetQueuesFromFile("/does/not/exist.yaml")).NotTo(Succeed())
+	})
+
+	It("should merge the queue preset into the job template", func() {
+		jt := drmaa2interface.JobTemplate{
+			JobCategory: "busybox",
+			QueueName:   "gpu",
+		}
+		req, _, err := tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		Expect(jt.ExtensionList).To(BeNil())
+		Expect(req.Job.Priority).To(Equal(int64(10)))
+		policy := req.Job.AllocationPolicy
+		Expect(policy.Instances[0].GetPolicy().MachineType).To(Equal("g2-standard-8"))
+		Expect(policy.Instances[0].GetPolicy().ProvisioningModel).To(Equal(batchpb.AllocationPolicy_SPOT))
+		Expect(policy.Network.NetworkInterfaces[0].Network).To(Equal("projects/p/global/networks/hpc"))
+		Expect(policy.Network.NetworkInterfaces[0].Subnetwork).To(Equal("projects/p/regions/us-central1/subnetworks/hpc"))
+		Expect(policy.ServiceAccount.Email).To(Equal("batch@p.iam.gserviceaccount.com"))
+		Expect(policy.Location.AllowedLocations).To(Equal([]string{"zones/us-central1-a"}))
+		Expect(req.Job.Labels).To(HaveKeyWithValue(LabelQueue, "gpu"))
+
+		req.Job.Status = &batchpb.JobStatus{}
+		ji, err := BatchJobToJobInfo("project", req.Job)
+		Expect(err).To(BeNil())
+		Expect(ji.QueueName).To(Equal("gpu"))
+
+		// settings of the job template take precedence
+		jt.CandidateMachines = []string{"g2-standard-4"}
+		jt.Priority = 1
+		// SetSpotExtension(jt, false) removes the extension
+		jt.ExtensionList = map[string]string{ExtensionSpot: "false"}
+		req, _, err = tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		Expect(req.Job.Priority).To(Equal(int64(1)))
+		policy = req.Job.AllocationPolicy
+		Expect(policy.Instances[0].GetPolicy().MachineType).To(Equal("g2-standard-4"))
+		Expect(policy.Instances[0].GetPolicy().ProvisioningModel).To(Equal(batchpb.AllocationPolicy_STANDARD))
+
+		jt.QueueName = "unknown"
+		_, _, err = tracker.PlanJob(jt)
+		Expect(err).To(HaveOccurred())
+	})
+
+})
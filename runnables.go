@@ -0,0 +1,217 @@
+package gcpbatchtracker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	"github.com/dgruber/drmaa2interface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	RunnableTypeContainer = "container"
+	RunnableTypeScript    = "script"
+	RunnableTypeBarrier   = "barrier"
+)
+
+// RunnableSpec describes one step of a task. An ordered list of runnables
+// set with SetRunnablesExtension() replaces the default layout of a task
+// (barrier, prolog, barrier, job, epilog). JobCategory, RemoteCommand, Args,
+// and the prolog and epilog extensions are then not used.
+type RunnableSpec struct {
+	// Type is "container", "script", or "barrier"
+	Type string `json:"type"`
+	// Name of the barrier
+	Name string `json:"name,omitempty"`
+	// Image is the container image
+	Image string `json:"image,omitempty"`
+	// Entrypoint of the container
+	Entrypoint string `json:"entrypoint,omitempty"`
+	// Commands are the arguments of the container entrypoint
+	Commands []string `json:"commands,omitempty"`
+	// Options are docker run options; when empty the options of the
+	// container security profile are used
+	Options string `json:"options,omitempty"`
+	// Volumes which are mounted into the container additionally
+	// to the volumes of the container security profile
+	Volumes []string `json:"volumes,omitempty"`
+	// Script is the script text
+	Script string `json:"script,omitempty"`
+	// ScriptPath is the path to the script
+	ScriptPath string `json:"script_path,omitempty"`
+	// Background runnables (sidecars) are not waited for
+	Background bool `json:"background,omitempty"`
+	// IgnoreExitStatus does not fail the task when the runnable fails
+	IgnoreExitStatus bool `json:"ignore_exit_status,omitempty"`
+	// AlwaysRun runs the runnable even when a previous one failed
+	AlwaysRun bool `json:"always_run,omitempty"`
+	// Environment variables of the runnable
+	Environment map[string]string `json:"environment,omitempty"`
+	// Timeout of the runnable (like "10m")
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// SetRunnablesExtension sets an ordered list of runnables which replaces
+// the default runnable layout of the task.
+func SetRunnablesExtension(jt drmaa2interface.JobTemplate, runnables []RunnableSpec) (drmaa2interface.JobTemplate, error) {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	encoded, err := json.Marshal(runnables)
+	if err != nil {
+		return jt, fmt.Errorf("could not encode runnables: %v", err)
+	}
+	jt.ExtensionList[ExtensionRunnables] = base64.StdEncoding.EncodeToString(encoded)
+	return jt, nil
+}
+
+func GetRunnablesExtension(jt drmaa2interface.JobTemplate) ([]RunnableSpec, bool) {
+	runnables, exists, err := getRunnablesExtension(jt)
+	if err != nil {
+		return nil, false
+	}
+	return runnables, exists
+}
+
+func getRunnablesExtension(jt drmaa2interface.JobTemplate) ([]RunnableSpec, bool, error) {
+	if jt.ExtensionList == nil {
+		return nil, false, nil
+	}
+	extension, hasExtension := jt.ExtensionList[ExtensionRunnables]
+	if !hasExtension {
+		return nil, false, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(extension)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not decode runnables: %v", err)
+	}
+	var runnables []RunnableSpec
+	if err := json.Unmarshal(decoded, &runnables); err != nil {
+		return nil, true, fmt.Errorf("could not unmarshal runnables: %v", err)
+	}
+	return runnables, true, nil
+}
+
+// ValidateRunnables checks if the runnables are complete. Barriers
+// are only allowed for parallel jobs.
+func ValidateRunnables(runnables []RunnableSpec, parallel bool) error {
+	if len(runnables) == 0 {
+		return fmt.Errorf("runnables extension contains no runnable")
+	}
+	for i, r := range runnables {
+		switch r.Type {
+		case RunnableTypeContainer:
+			if r.Image == "" {
+				return fmt.Errorf("runnable %d: container requires an image", i)
+			}
+		case RunnableTypeScript:
+			if (r.Script == "") == (r.ScriptPath == "") {
+				return fmt.Errorf("runnable %d: script requires either a script or a script path", i)
+			}
+		case RunnableTypeBarrier:
+			if !parallel {
+				return fmt.Errorf("runnable %d: barriers require MinSlots = MaxSlots", i)
+			}
+		default:
+			return fmt.Errorf("runnable %d: unknown type %q", i, r.Type)
+		}
+		if r.Timeout != "" {
+			if _, err := time.ParseDuration(r.Timeout); err != nil {
+				return fmt.Errorf("runnable %d: invalid timeout %s: %v", i, r.Timeout, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertRunnables converts the runnables into Google Batch runnables.
+// Containers get the registry credentials, container options, security
+// profile, and GPU devices defined in the job template.
+func ConvertRunnables(jt drmaa2interface.JobTemplate, runnables []RunnableSpec) ([]*batchpb.Runnable, error) {
+	converted := make([]*batchpb.Runnable, 0, len(runnables))
+	for i, r := range runnables {
+		runnable := &batchpb.Runnable{
+			IgnoreExitStatus: r.IgnoreExitStatus,
+			Background:       r.Background,
+			AlwaysRun:        r.AlwaysRun,
+		}
+		switch r.Type {
+		case RunnableTypeContainer:
+			container, err := CreateContainer(jt, r.Image, r.Entrypoint, r.Commands)
+			if err != nil {
+				return nil, err
+			}
+			container.Volumes = append(container.Volumes, r.Volumes...)
+			if r.Options != "" {
+				container.Options = r.Options
+			}
+			runnable.Executable = &batchpb.Runnable_Container_{
+				Container: container,
+			}
+		case RunnableTypeScript:
+			script := &batchpb.Runnable_Script{}
+			if r.ScriptPath != "" {
+				script.Command = &batchpb.Runnable_Script_Path{
+					Path: r.ScriptPath,
+				}
+			} else {
+				script.Command = &batchpb.Runnable_Script_Text{
+					Text: r.Script,
+				}
+			}
+			runnable.Executable = &batchpb.Runnable_Script_{
+				Script: script,
+			}
+		case RunnableTypeBarrier:
+			name := r.Name
+			if name == "" {
+				name = fmt.Sprintf("barrier_%d", i)
+			}
+			runnable.Executable = &batchpb.Runnable_Barrier_{
+				Barrier: &batchpb.Runnable_Barrier{
+					Name: name,
+				},
+			}
+		default:
+			return nil, fmt.Errorf("runnable %d: unknown type %q", i, r.Type)
+		}
+		if len(r.Environment) > 0 {
+			runnable.Environment = &batchpb.Environment{
+				Variables: r.Environment,
+			}
+		}
+		if r.Timeout != "" {
+			timeout, err := time.ParseDuration(r.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("runnable %d: invalid timeout %s: %v", i, r.Timeout, err)
+			}
+			runnable.Timeout = durationpb.New(timeout)
+		}
+		converted = append(converted, runnable)
+	}
+	return converted, nil
+}
+
+// hasContainerRunnable returns true if one of the runnables is a container.
+func hasContainerRunnable(runnables []RunnableSpec) bool {
+	for _, r := range runnables {
+		if r.Type == RunnableTypeContainer {
+			return true
+		}
+	}
+	return false
+}
+
+// containerPositions returns the indices of all container runnables.
+func containerPositions(runnables []*batchpb.Runnable) []int {
+	var positions []int
+	for i, r := range runnables {
+		if _, isContainer := r.Executable.(*batchpb.Runnable_Container_); isContainer {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
@@ -0,0 +1,129 @@
+package gcpbatchtracker_test
+
+import (
+	"time"
+
+	"cloud.google.com/go/batch/apiv1/batchpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Runnables", func() {
+
+	runnables := []RunnableSpec{
+		{
+			Type:       RunnableTypeContainer,
+			Image:      "prom/node-exporter",
+			Background: true,
+		},
+		{
+			Type:        RunnableTypeScript,
+			Script:      "echo preparing",
+			Environment: map[string]string{"STEP": "prepare"},
+		},
+		{
+			Type:       RunnableTypeContainer,
+			Image:      "ubuntu:22.04",
+			Entrypoint: "/bin/sh",
+			Commands:   []string{"-c", "echo compute"},
+			Timeout:    "10m",
+		},
+		{
+			Type:       RunnableTypeScript,
+			ScriptPath: "/opt/cleanup.sh",
+			AlwaysRun:  true,
+		},
+	}
+
+	It("should set and get the runnables extension", func() {
+		jt := drmaa2interface.JobTemplate{}
+		_, exists := GetRunnablesExtension(jt)
+		Expect(exists).To(BeFalse())
+		jt, err := SetRunnablesExtension(jt, runnables)
+		Expect(err).To(BeNil())
+		r, exists := GetRunnablesExtension(jt)
+		Expect(exists).To(BeTrue())
+		Expect(r).To(Equal(runnables))
+	})
+
+	It("should replace the default runnable layout", func() {
+		jt := drmaa2interface.JobTemplate{
+			MaxSlots:          4,
+			CandidateMachines: []string{"e2-standard-4"},
+			StageInFiles: map[string]string{
+				"/data": "gs://inputbucket",
+			},
+		}
+		jt, err := SetRunnablesExtension(jt, runnables)
+		Expect(err).To(BeNil())
+
+		req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		r := req.Job.TaskGroups[0].TaskSpec.Runnables
+		Expect(r).To(HaveLen(4))
+
+		Expect(r[0].Background).To(BeTrue())
+		Expect(r[0].GetContainer().ImageUri).To(Equal("prom/node-exporter"))
+		Expect(r[1].GetScript().GetText()).To(Equal("echo preparing"))
+		Expect(r[1].Environment.Variables).To(HaveKeyWithValue("STEP", "prepare"))
+		Expect(r[2].GetContainer().Entrypoint).To(Equal("/bin/sh"))
+		Expect(r[2].Timeout).To(Equal(durationpb.New(10 * time.Minute)))
+		Expect(r[3].GetScript().GetPath()).To(Equal("/opt/cleanup.sh"))
+		Expect(r[3].AlwaysRun).To(BeTrue())
+
+		// stage in bucket is mounted into all containers
+		Expect(r[0].GetContainer().Volumes).To(ContainElement("/data:/data"))
+		Expect(r[2].GetContainer().Volumes).To(ContainElement("/data:/data"))
+		Expect(req.Job.TaskGroups[0].TaskSpec.Volumes).To(HaveLen(1))
+	})
+
+	It("should reject invalid runnables", func() {
+		jt := drmaa2interface.JobTemplate{
+			MinSlots:          1,
+			MaxSlots:          4,
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+		invalid := [][]RunnableSpec{
+			{},
+			{{Type: RunnableTypeContainer}},
+			{{Type: RunnableTypeScript}},
+			{{Type: RunnableTypeBarrier}}, // not a parallel job
+			{{Type: "unknown"}},
+			{{Type: RunnableTypeScript, Script: "echo", Timeout: "never"}},
+		}
+		for _, r := range invalid {
+			jt, err := SetRunnablesExtension(jt, r)
+			Expect(err).To(BeNil())
+			_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+			Expect(err).To(HaveOccurred())
+		}
+
+		jt, err := SetRunnablesExtension(jt, runnables)
+		Expect(err).To(BeNil())
+		jt = SetMachinePrologExtension(jt, "echo prolog")
+		_, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should set barriers for parallel jobs", func() {
+		jt := drmaa2interface.JobTemplate{
+			MinSlots:          2,
+			MaxSlots:          2,
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+		jt, err := SetRunnablesExtension(jt, []RunnableSpec{
+			{Type: RunnableTypeBarrier},
+			{Type: RunnableTypeScript, Script: "mpirun"},
+		})
+		Expect(err).To(BeNil())
+		req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		barrier := req.Job.TaskGroups[0].TaskSpec.Runnables[0].Executable.(*batchpb.Runnable_Barrier_)
+		Expect(barrier.Barrier.Name).To(Equal("barrier_0"))
+	})
+
+})
@@ -0,0 +1,176 @@
+package gcpbatchtracker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dgruber/drmaa2interface"
+)
+
+// In strict validation mode inputs of the job template which are
+// otherwise ignored (see JobTemplateWarnings()) are errors. Also
+// malformed extensions, unsupported stage in sources, and options
+// which can't be combined are reported. All problems are returned
+// at once as *ValidationError.
+
+// ValidationError contains all problems found by the strict
+// validation of a job template.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("invalid job template: %s", strings.Join(messages, "; "))
+}
+
+// Unwrap returns all problems of the job template.
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// SetStrictValidationExtension enables or disables the strict validation
+// of the job template (see SetStrictValidation()). It overrides the
+// setting of the tracker for this job.
+func SetStrictValidationExtension(jt drmaa2interface.JobTemplate, strict bool) drmaa2interface.JobTemplate {
+	if jt.ExtensionList == nil {
+		jt.ExtensionList = make(map[string]string)
+	}
+	jt.ExtensionList[ExtensionStrictValidation] = strconv.FormatBool(strict)
+	return jt
+}
+
+// GetStrictValidationExtension returns if strict validation is enabled
+// for the job template and, as second value, if the extension is set at
+// all. A value which is not a bool reads as false (strict validation
+// itself rejects it).
+func GetStrictValidationExtension(jt drmaa2interface.JobTemplate) (bool, bool) {
+	if jt.ExtensionList == nil {
+		return false, false
+	}
+	value, exists := jt.ExtensionList[ExtensionStrictValidation]
+	if !exists {
+		return false, false
+	}
+	strict, _ := strconv.ParseBool(value)
+	return strict, true
+}
+
+// SetStrictValidation enables the strict validation for all job
+// templates which do not set the strict validation extension.
+func (t *GCPBatchTracker) SetStrictValidation(strict bool) {
+	t.strictValidation = strict
+}
+
+// applyStrictValidation sets the strict validation extension in the
+// job template if it is enabled for the tracker and not defined by
+// the job template.
+func (t *GCPBatchTracker) applyStrictValidation(jt drmaa2interface.JobTemplate) drmaa2interface.JobTemplate {
+	if !t.strictValidation {
+		return jt
+	}
+	if _, exists := GetStrictValidationExtension(jt); exists {
+		return jt
+	}
+	// don't modify the extension list of the caller
+	extensions := make(map[string]string, len(jt.ExtensionList)+1)
+	for k, v := range jt.ExtensionList {
+		extensions[k] = v
+	}
+	jt.ExtensionList = extensions
+	return SetStrictValidationExtension(jt, true)
+}
+
+// strictValidationErrors returns all problems of the job template
+// which are ignored when strict validation is disabled.
+func strictValidationErrors(jt drmaa2interface.JobTemplate) []error {
+	errs := []error{}
+	for _, warning := range JobTemplateWarnings(jt) {
+		errs = append(errs, fmt.Errorf("%s", warning))
+	}
+	if value, exists := jt.ExtensionList[ExtensionStrictValidation]; exists {
+		if _, err := strconv.ParseBool(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid strict validation extension: %s", value))
+		}
+	}
+	if value, exists := jt.ExtensionList[ExtensionAccelerators]; exists {
+		parts := strings.Split(value, "*")
+		if len(parts) > 2 || parts[len(parts)-1] == "" {
+			errs = append(errs, fmt.Errorf("invalid accelerators extension (<count>*<type>): %s", value))
+		} else if len(parts) == 2 {
+			if count, err := strconv.ParseInt(parts[0], 10, 64); err != nil || count <= 0 {
+				errs = append(errs, fmt.Errorf("invalid accelerator count: %s", value))
+			}
+		}
+	}
+	for _, extension := range []string{ExtensionSpot, ExtensionContainerImageStreaming,
+		ExtensionContainerBlockExternalNetwork} {
+		if value, exists := jt.ExtensionList[extension]; exists {
+			if _, err := strconv.ParseBool(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s extension (true/false): %s", extension, value))
+			}
+		}
+	}
+	if value, exists := jt.ExtensionList[ExtensionTasksPerNode]; exists {
+		if tasks, err := strconv.ParseInt(value, 10, 64); err != nil || tasks <= 0 {
+			errs = append(errs, fmt.Errorf("invalid tasks per node: %s", value))
+		}
+	}
+	for _, destination := range sortedKeys(jt.StageInFiles) {
+		source := jt.StageInFiles[destination]
+		if strings.HasPrefix(source, "gs://") || strings.HasPrefix(source, "nfs:") {
+			continue
+		}
+		if strings.HasPrefix(source, "locahost:") {
+			errs = append(errs, fmt.Errorf("unsupported stage in source %s (did you mean localhost:?)", source))
+		} else if _, isHostPath := localhostPath(source); !isHostPath {
+			errs = append(errs, fmt.Errorf("unsupported stage in source %s for %s", source, destination))
+		}
+	}
+	errs = append(errs, incompatibleOptions(jt)...)
+	return errs
+}
+
+// incompatibleOptions returns errors for options of the job template
+// which are ignored because of other options.
+func incompatibleOptions(jt drmaa2interface.JobTemplate) []error {
+	errs := []error{}
+	spot, _ := GetSpotExtension(jt)
+	_, hasAccelerators := jt.ExtensionList[ExtensionAccelerators]
+	if len(jt.CandidateMachines) > 0 && strings.HasPrefix(jt.CandidateMachines[0], "template:") {
+		if spot {
+			errs = append(errs, fmt.Errorf("spot extension cannot be combined with an instance template"))
+		}
+		if hasAccelerators {
+			errs = append(errs, fmt.Errorf("accelerators extension cannot be combined with an instance template"))
+		}
+		if jt.MachineArch != "" {
+			errs = append(errs, fmt.Errorf("MachineArch cannot be combined with an instance template"))
+		}
+	}
+	if _, hasReservation := GetReservationExtension(jt); hasReservation && spot {
+		errs = append(errs, fmt.Errorf("spot extension cannot be combined with a reservation"))
+	}
+	if _, hasDockerOptions := GetDockerOptionsExtension(jt); hasDockerOptions {
+		runnables, hasCustomRunnables := GetRunnablesExtension(jt)
+		if (hasCustomRunnables && !hasContainerRunnable(runnables)) ||
+			(!hasCustomRunnables && (jt.JobCategory == JobCategoryScript ||
+				jt.JobCategory == JobCategoryScriptPath)) {
+			errs = append(errs, fmt.Errorf("docker options set but no container image set"))
+		}
+	}
+	return errs
+}
+
+// localhostPath returns the host path of a "localhost:" stage in
+// source.
+func localhostPath(source string) (string, bool) {
+	if !strings.HasPrefix(source, "localhost:") {
+		return "", false
+	}
+	return strings.TrimPrefix(source, "localhost:"), true
+}
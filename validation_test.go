@@ -0,0 +1,120 @@
+package gcpbatchtracker_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/drmaa2interface"
+	. "github.com/dgruber/gcpbatchtracker"
+)
+
+var _ = Describe("Validation", func() {
+
+	var jt drmaa2interface.JobTemplate
+
+	BeforeEach(func() {
+		jt = drmaa2interface.JobTemplate{
+			RemoteCommand:     "/bin/sh",
+			JobCategory:       "busybox",
+			CandidateMachines: []string{"e2-standard-4"},
+			ResourceLimits: map[string]string{
+				ResourceLimitRuntime:  "1 hour",
+				ResourceLimitBootDisk: "ten",
+				ResourceLimitCPUMilli: "2000",
+			},
+			StageInFiles: map[string]string{
+				"/data":   "gs://bucket",
+				"/host":   "locahost:/mnt/share",
+				"/inline": "b64data:aGVsbG8=",
+			},
+		}
+		jt.ExtensionList = map[string]string{
+			ExtensionAccelerators: "abc*nvidia-tesla-t4",
+			"unknown":             "value",
+		}
+	})
+
+	It("should ignore problems when strict validation is disabled", func() {
+		_, err := ValidateJobTemplate(jt)
+		Expect(err).To(BeNil())
+	})
+
+	It("should return all problems when strict validation is enabled", func() {
+		jt = SetStrictValidationExtension(jt, true)
+		_, err := ValidateJobTemplate(jt)
+		Expect(err).To(HaveOccurred())
+		var validationError *ValidationError
+		Expect(errors.As(err, &validationError)).To(BeTrue())
+		Expect(validationError.Errors).To(HaveLen(6))
+		Expect(err.Error()).To(ContainSubstring("ResourceLimits[bootdiskmib]"))
+		Expect(err.Error()).To(ContainSubstring("ResourceLimits[runtime]"))
+		Expect(err.Error()).To(ContainSubstring("ExtensionList[unknown]"))
+		Expect(err.Error()).To(ContainSubstring("invalid accelerator count"))
+		Expect(err.Error()).To(ContainSubstring("did you mean localhost:?"))
+		Expect(err.Error()).To(ContainSubstring("b64data:aGVsbG8="))
+	})
+
+	It("should report incompatible options", func() {
+		jt = drmaa2interface.JobTemplate{
+			RemoteCommand:     "echo hello",
+			JobCategory:       JobCategoryScript,
+			MinSlots:          2,
+			MaxSlots:          2,
+			CandidateMachines: []string{"e2-standard-4"},
+		}
+		jt = SetStrictValidationExtension(jt, true)
+		_, err := ValidateJobTemplate(jt)
+		Expect(err).To(BeNil())
+
+		jt = SetSpotExtension(jt, true)
+		jt = SetReservationExtension(jt, "my-reservation")
+		jt = SetDockerOptionsExtension(jt, "--rm")
+		_, err = ValidateJobTemplate(jt)
+		var validationError *ValidationError
+		Expect(errors.As(err, &validationError)).To(BeTrue())
+		Expect(validationError.Errors).To(HaveLen(2))
+
+		// errors of the regular validation are included
+		jt.MinSlots = 1
+		_, err = ValidateJobTemplate(jt)
+		Expect(errors.As(err, &validationError)).To(BeTrue())
+		Expect(validationError.Errors).To(HaveLen(3))
+	})
+
+	It("should enable strict validation for the tracker", func() {
+		tracker := &GCPBatchTracker{}
+		_, _, err := tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+		tracker.SetStrictValidation(true)
+		_, _, err = tracker.PlanJob(jt)
+		Expect(err).To(HaveOccurred())
+		Expect(jt.ExtensionList).NotTo(HaveKey(ExtensionStrictValidation))
+
+		// the job template setting overrules the tracker setting
+		jt = SetStrictValidationExtension(jt, false)
+		_, _, err = tracker.PlanJob(jt)
+		Expect(err).To(BeNil())
+	})
+
+	It("should mount localhost paths into the container", func() {
+		jt.StageInFiles = map[string]string{"/host": "localhost:/mnt/share"}
+		req, err := ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		volumes := []string{}
+		for _, runnable := range req.Job.TaskGroups[0].TaskSpec.Runnables {
+			volumes = append(volumes, runnable.GetContainer().GetVolumes()...)
+		}
+		Expect(volumes).To(ContainElement("/mnt/share:/host"))
+
+		// the misspelled prefix is not mounted
+		jt.StageInFiles = map[string]string{"/host": "locahost:/mnt/share"}
+		req, err = ConvertJobTemplateToJobRequest("", "project", "location", jt)
+		Expect(err).To(BeNil())
+		for _, runnable := range req.Job.TaskGroups[0].TaskSpec.Runnables {
+			Expect(runnable.GetContainer().GetVolumes()).NotTo(ContainElement(HaveSuffix(":/host")))
+		}
+	})
+
+})